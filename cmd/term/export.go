@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sambigeara/fuzzynote/pkg/service"
+)
+
+const (
+	exportFormatICS  = "ics"
+	defaultServeAddr = "localhost:8080"
+)
+
+// runExport handles `fzn export --format ics [--todo] [--serve [addr]]`. The calendar is written to stdout, or served
+// over HTTP (e.g. for subscription from a calendar app) if `--serve` is passed, in which case the local state is
+// reloaded on each request.
+func runExport(listRepo *service.DBListRepo, args []string) error {
+	format, serveAddr, component := "", "", service.ICSEvent
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--format":
+			if i+1 < len(args) {
+				i++
+				format = args[i]
+			}
+		case "--todo":
+			component = service.ICSTodo
+		case "--serve":
+			serveAddr = defaultServeAddr
+			if i+1 < len(args) && len(args[i+1]) > 0 && args[i+1][0] != '-' {
+				i++
+				serveAddr = args[i]
+			}
+		default:
+			return fmt.Errorf("unrecognised export arg: %s", args[i])
+		}
+	}
+	if format != exportFormatICS {
+		return errors.New("please specify a supported format via `--format`, one of: ics.\ne.g: `./fzn export --format ics > fzn.ics`")
+	}
+
+	ctx := context.Background()
+	if serveAddr == "" {
+		if err := listRepo.LoadLocal(ctx); err != nil {
+			return err
+		}
+		return listRepo.ExportICS(os.Stdout, component, time.Now())
+	}
+
+	// The listRepo isn't safe for concurrent use, so requests are served one at a time
+	var mut sync.Mutex
+	http.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
+		mut.Lock()
+		defer mut.Unlock()
+		if err := listRepo.LoadLocal(req.Context()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		if err := listRepo.ExportICS(w, component, time.Now()); err != nil {
+			log.Print(err)
+		}
+	})
+	fmt.Printf("serving calendar at http://%s/fzn.ics\n", serveAddr)
+	return http.ListenAndServe(serveAddr, nil)
+}
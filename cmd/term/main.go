@@ -12,16 +12,18 @@ import (
 	"github.com/ardanlabs/conf"
 
 	"github.com/sambigeara/fuzzynote/pkg/prompt"
-	"github.com/sambigeara/fuzzynote/pkg/s3"
 	"github.com/sambigeara/fuzzynote/pkg/service"
 	"github.com/sambigeara/fuzzynote/pkg/term"
 )
 
 const (
-	namespace = "FZN"
-	loginArg  = "login"
-	deleteArg = "delete"
-	importArg = "import"
+	namespace  = "FZN"
+	loginArg   = "login"
+	deleteArg  = "delete"
+	importArg  = "import"
+	backupArg  = "backup"
+	restoreArg = "restore"
+	exportArg  = "export"
 )
 
 var (
@@ -35,7 +37,15 @@ func main() {
 		Root    string
 		Colour  string `conf:"default:light"`
 		Editor  string `conf:"default:vim"`
-		Args    conf.Args
+		Preview string `conf:"default:off"`
+
+		CompactionMaxWals   int           `conf:"default:50"`
+		CompactionMaxEvents int           `conf:"default:2000"`
+		CompactionMaxAge    time.Duration `conf:"default:1h"`
+		TombstoneHorizon    time.Duration `conf:"default:720h"`
+		BackupRetention     int           `conf:"default:10"`
+
+		Args conf.Args
 	}
 
 	// Pre-instantiate default root direct (can't pass value dynamically to default above)
@@ -83,7 +93,40 @@ func main() {
 		case loginArg:
 			prompt.Login(cfg.Root)
 		case deleteArg:
+			// Snapshot the state first, so the delete can be reverted via `restore`
+			if _, err := newLocalRepo(localWalFile, cfg.Root, cfg.BackupRetention).Backup(context.Background()); err != nil {
+				fmt.Println("failed to backup prior to delete:", err)
+				os.Exit(1)
+			}
 			localWalFile.Purge()
+		case backupArg:
+			name, err := newLocalRepo(localWalFile, cfg.Root, cfg.BackupRetention).Backup(context.Background())
+			if err != nil {
+				fmt.Println("failed to backup:", err)
+				os.Exit(1)
+			}
+			fmt.Println("created backup:", name)
+			os.Exit(0)
+		case restoreArg:
+			snapshot := cfg.Args.Num(1)
+			if snapshot == "" {
+				names, err := service.ListBackups(cfg.Root)
+				if err != nil || len(names) == 0 {
+					fmt.Println("no backups found in", path.Join(cfg.Root, service.BackupDirName))
+					os.Exit(0)
+				}
+				fmt.Println("please specify a backup to restore, e.g: `./fzn restore " + names[0] + "`. Available backups (newest first):")
+				for _, n := range names {
+					fmt.Println(n)
+				}
+				os.Exit(0)
+			}
+			if err := newLocalRepo(localWalFile, cfg.Root, cfg.BackupRetention).Restore(context.Background(), snapshot); err != nil {
+				fmt.Println("failed to restore:", err)
+				os.Exit(1)
+			}
+			fmt.Println("restored backup:", snapshot)
+			os.Exit(0)
 		case importArg:
 			// Gather and assert existence of the remaining args.
 			// Bit of an odd way of handling it, but we need to assert existence of `--show` or `--hide` explicitly, and then accept any
@@ -128,6 +171,12 @@ func main() {
 				os.Exit(1)
 			}
 			os.Exit(0)
+		case exportArg:
+			if err := runExport(newLocalRepo(localWalFile, cfg.Root, cfg.BackupRetention), cfg.Args[1:]); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			os.Exit(0)
 		default:
 			fmt.Println("unrecognised arg:", cfg.Args.Num(0))
 			os.Exit(0)
@@ -142,17 +191,33 @@ func main() {
 		localWalFile,
 		webTokens,
 	)
+	listRepo.SetCompactionConfig(service.CompactionConfig{
+		MaxDeltaWals:     cfg.CompactionMaxWals,
+		MaxDeltaEvents:   cfg.CompactionMaxEvents,
+		MaxCheckpointAge: cfg.CompactionMaxAge,
+	})
+	listRepo.SetTombstoneHorizon(cfg.TombstoneHorizon)
+	listRepo.SetBackupRetention(cfg.BackupRetention)
 
-	s3Remotes := s3.GetS3Config(cfg.Root)
-	for _, r := range s3Remotes {
-		// centralise this logic across different remote types when relevant
-		// TODO gracefully deal with missing config
-		s3FileWal := s3.NewS3WalFile(r, cfg.Root)
-		listRepo.AddWalFile(s3FileWal, true)
-	}
+	// Remote config errors are displayed once the client starts, but don't prevent the app from starting
+	remoteErr := addRemotes(listRepo, cfg.Root)
 
 	// Create term client
-	client := term.NewTerm(listRepo, cfg.Colour, cfg.Editor)
+	client, err := term.NewTerm(listRepo, cfg.Colour, cfg.Editor, cfg.Preview)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if remoteErr != nil {
+		client.SetFooterMessage(remoteErr.Error())
+	}
 
 	fmt.Println(listRepo.Start(client))
 }
+
+// newLocalRepo returns a listRepo for the backup, restore and export flows, which operate on the local walfile only
+func newLocalRepo(localWalFile *service.LocalFileWalFile, root string, retention int) *service.DBListRepo {
+	listRepo := service.NewDBListRepo(localWalFile, service.NewFileWebTokenStore(root))
+	listRepo.SetBackupRetention(retention)
+	return listRepo
+}
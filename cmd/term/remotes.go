@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/sambigeara/fuzzynote/pkg/git"
+	"github.com/sambigeara/fuzzynote/pkg/s3"
+	"github.com/sambigeara/fuzzynote/pkg/service"
+	"github.com/sambigeara/fuzzynote/pkg/sftp"
+	"github.com/sambigeara/fuzzynote/pkg/webdav"
+)
+
+const configFileName = "config.yml"
+
+// remotesConfig holds the remotes configured in the root directory
+type remotesConfig struct {
+	S3     []s3.S3Remote
+	Git    []git.GitRemote
+	SFTP   []sftp.SFTPRemote
+	WebDAV []webdav.WebDAVRemote
+}
+
+// remote defers construction of the WalFile, so each can fail independently
+type remote struct {
+	kind, name string
+	sync       string
+	match      []string
+	new        func() (service.WalFile, error)
+}
+
+// loadRemotesConfig parses the config file in the root directory. A missing config file is not an error.
+func loadRemotesConfig(root string) (remotesConfig, error) {
+	cfg := remotesConfig{}
+	cfgFile := path.Join(root, configFileName)
+	f, err := os.Open(cfgFile)
+	if err != nil {
+		return cfg, nil
+	}
+	defer f.Close()
+
+	if err := yaml.NewDecoder(f).Decode(&cfg); err != nil && err != io.EOF {
+		return cfg, fmt.Errorf("parsing %s: %w", cfgFile, err)
+	}
+	return cfg, nil
+}
+
+func (cfg remotesConfig) remotes(root string) []remote {
+	remotes := []remote{}
+	for _, r := range cfg.S3 {
+		r := r
+		remotes = append(remotes, remote{"s3", r.Bucket, r.Sync, r.Match, func() (service.WalFile, error) {
+			return s3.NewS3WalFile(r, root)
+		}})
+	}
+	for _, r := range cfg.Git {
+		r := r
+		remotes = append(remotes, remote{"git", r.Path, r.Sync, r.Match, func() (service.WalFile, error) {
+			return git.NewGitWalFile(r, root)
+		}})
+	}
+	for _, r := range cfg.SFTP {
+		r := r
+		remotes = append(remotes, remote{"sftp", r.Host, r.Sync, r.Match, func() (service.WalFile, error) {
+			return sftp.NewSFTPWalFile(r)
+		}})
+	}
+	for _, r := range cfg.WebDAV {
+		r := r
+		remotes = append(remotes, remote{"webdav", r.URL, r.Sync, r.Match, func() (service.WalFile, error) {
+			return webdav.NewWebDAVWalFile(r)
+		}})
+	}
+	return remotes
+}
+
+// addRemotes registers all remotes configured in the root directory. Remotes which fail to configure are skipped,
+// and the errors are returned together.
+func addRemotes(listRepo *service.DBListRepo, root string) error {
+	cfg, err := loadRemotesConfig(root)
+	if err != nil {
+		return fmt.Errorf("unable to load remotes: %w", err)
+	}
+	errs := []string{}
+	for _, r := range cfg.remotes(root) {
+		wf, err := r.new()
+		if err == nil {
+			err = addRemote(listRepo, wf, r.sync, r.match)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("unable to configure %s remote %q: %v", r.kind, r.name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// addRemote registers an owned remote with the sync policy from config.yml
+func addRemote(listRepo *service.DBListRepo, wf service.WalFile, sync string, match []string) error {
+	direction, err := service.ParseSyncDirection(sync)
+	if err != nil {
+		return err
+	}
+	listRepo.AddWalFileWithPolicy(wf, service.WalFilePolicy{
+		Direction: direction,
+		Match:     match,
+	})
+	return nil
+}
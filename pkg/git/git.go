@@ -0,0 +1,255 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	walFilePattern = "wal_%v.db" // TODO dedup, as is in service package
+
+	// fetchInterval limits how often GetMatchingWals fetches from the upstream, as it's called on every pull
+	fetchInterval = time.Second * 30
+
+	// pushAttempts is the number of times a rejected push is retried, following a rebase
+	pushAttempts = 3
+
+	defaultAuthorName  = "fzn"
+	defaultAuthorEmail = "fzn@localhost"
+)
+
+// GitRemote configures a local git repository as a remote. If URL is set, the repository is cloned from it if
+// Path doesn't exist, and changes are pushed to and pulled from the "origin" remote on the current branch.
+// Otherwise, the repository is initialised at Path, and only committed to locally.
+type GitRemote struct {
+	Path   string // relative paths are resolved against the fzn root directory
+	URL    string
+	Prefix string // the directory within the repository in which the wals are stored
+	Sync   string
+	Match  []string
+}
+
+// gitWalFile stores wals as files in a git working tree, committing on every Flush and RemoveWals. Wal names are
+// unique and their content immutable, so concurrent changes from other devices can always be rebased cleanly.
+type gitWalFile struct {
+	// git operations on the working tree must be serialised
+	mut       sync.Mutex
+	dir       string
+	prefix    string
+	hasRemote bool
+	lastFetch time.Time
+}
+
+// NewGitWalFile opens (or creates) the repository. Relative paths are resolved against the root directory.
+func NewGitWalFile(cfg GitRemote, root string) (*gitWalFile, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, err
+	}
+	if cfg.Path == "" {
+		return nil, errors.New("path is required")
+	}
+	dir := cfg.Path
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(root, dir)
+	}
+
+	wf := &gitWalFile{
+		dir:       dir,
+		prefix:    cfg.Prefix,
+		hasRemote: cfg.URL != "",
+	}
+
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if cfg.URL != "" {
+			if _, err := runGit(context.Background(), "", "clone", "--quiet", cfg.URL, dir); err != nil {
+				return nil, err
+			}
+		} else if _, err := runGit(context.Background(), "", "init", "--quiet", dir); err != nil {
+			return nil, err
+		}
+	}
+
+	// Commits fail if no identity is configured, so fall back to a repository local one
+	if _, err := wf.git(context.Background(), "config", "user.email"); err != nil {
+		if _, err := wf.git(context.Background(), "config", "user.name", defaultAuthorName); err != nil {
+			return nil, err
+		}
+		if _, err := wf.git(context.Background(), "config", "user.email", defaultAuthorEmail); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, cfg.Prefix), os.ModePerm); err != nil {
+		return nil, err
+	}
+	return wf, nil
+}
+
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func (wf *gitWalFile) git(ctx context.Context, args ...string) (string, error) {
+	return runGit(ctx, wf.dir, args...)
+}
+
+func (wf *gitWalFile) GetUUID() string {
+	return wf.dir + ":" + wf.GetRoot()
+}
+
+func (wf *gitWalFile) GetRoot() string {
+	return wf.prefix
+}
+
+func (wf *gitWalFile) walPath(fileName string) string {
+	return filepath.Join(wf.dir, fmt.Sprintf(path.Join(wf.GetRoot(), walFilePattern), fileName))
+}
+
+// sync fetches from the upstream, and rebases any local commits on top
+func (wf *gitWalFile) sync(ctx context.Context) error {
+	if !wf.hasRemote {
+		return nil
+	}
+	if _, err := wf.git(ctx, "fetch", "--quiet", "origin"); err != nil {
+		return err
+	}
+	wf.lastFetch = time.Now()
+
+	branch, err := wf.git(ctx, "symbolic-ref", "--short", "HEAD")
+	if err != nil {
+		return err
+	}
+	upstream := "origin/" + branch
+	if _, err := wf.git(ctx, "rev-parse", "--verify", "--quiet", upstream); err != nil {
+		// Nothing has been pushed to the branch yet
+		return nil
+	}
+	if _, err := wf.git(ctx, "rev-parse", "--verify", "--quiet", "HEAD"); err != nil {
+		// Nothing has been committed locally yet, so there is nothing to rebase
+		_, err = wf.git(ctx, "reset", "--quiet", "--hard", upstream)
+		return err
+	}
+	if _, err := wf.git(ctx, "rebase", "--quiet", upstream); err != nil {
+		wf.git(ctx, "rebase", "--abort")
+		return err
+	}
+	return nil
+}
+
+// commit commits any staged changes, and pushes them to the upstream, if present
+func (wf *gitWalFile) commit(ctx context.Context, msg string) error {
+	// `diff --cached --quiet` exits non-zero if there are staged changes
+	if _, err := wf.git(ctx, "diff", "--cached", "--quiet"); err == nil {
+		return nil
+	}
+	if _, err := wf.git(ctx, "commit", "--quiet", "-m", msg); err != nil {
+		return err
+	}
+	if !wf.hasRemote {
+		return nil
+	}
+
+	// Pushes are rejected if other devices have pushed in the meantime, in which case we rebase and retry
+	var err error
+	for i := 0; i < pushAttempts; i++ {
+		if _, err = wf.git(ctx, "push", "--quiet", "origin", "HEAD"); err == nil {
+			return nil
+		}
+		if err := wf.sync(ctx); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+func (wf *gitWalFile) GetMatchingWals(ctx context.Context, matchPattern string) ([]string, error) {
+	wf.mut.Lock()
+	defer wf.mut.Unlock()
+
+	if time.Since(wf.lastFetch) >= fetchInterval {
+		if err := wf.sync(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	// The pattern is relative to the root of the repository
+	paths, err := filepath.Glob(filepath.Join(wf.dir, matchPattern))
+	if err != nil {
+		return nil, err
+	}
+	fileNames := []string{}
+	for _, p := range paths {
+		fileNames = append(fileNames, strings.Split(strings.Split(filepath.Base(p), "_")[1], ".")[0])
+	}
+	return fileNames, nil
+}
+
+func (wf *gitWalFile) GetWalBytes(ctx context.Context, w io.Writer, fileName string) error {
+	wf.mut.Lock()
+	defer wf.mut.Unlock()
+
+	f, err := os.Open(wf.walPath(fileName))
+	if err != nil {
+		// If the file has been removed, skip, as it means another process has already merged
+		// and deleted this one
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func (wf *gitWalFile) RemoveWals(ctx context.Context, fileNames []string) error {
+	wf.mut.Lock()
+	defer wf.mut.Unlock()
+
+	args := []string{"rm", "--quiet", "--cached", "--ignore-unmatch", "--"}
+	for _, f := range fileNames {
+		p := wf.walPath(f)
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		args = append(args, p)
+	}
+	if _, err := wf.git(ctx, args...); err != nil {
+		return err
+	}
+	return wf.commit(ctx, fmt.Sprintf("Remove %d wals", len(fileNames)))
+}
+
+func (wf *gitWalFile) Flush(ctx context.Context, b *bytes.Buffer, fileName string) error {
+	wf.mut.Lock()
+	defer wf.mut.Unlock()
+
+	p := wf.walPath(fileName)
+	if err := os.WriteFile(p, b.Bytes(), 0644); err != nil {
+		return err
+	}
+	if _, err := wf.git(ctx, "add", "--", p); err != nil {
+		return err
+	}
+	return wf.commit(ctx, fmt.Sprintf("Add %s", filepath.Base(p)))
+}
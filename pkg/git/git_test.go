@@ -0,0 +1,77 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGitWalFile(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	ctx := context.Background()
+
+	root := t.TempDir()
+	upstream := filepath.Join(root, "upstream.git")
+	if _, err := runGit(ctx, "", "init", "--quiet", "--bare", upstream); err != nil {
+		t.Fatal(err)
+	}
+
+	newWalFile := func(name string) *gitWalFile {
+		wf, err := NewGitWalFile(GitRemote{Path: name, URL: upstream, Prefix: "wals"}, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return wf
+	}
+	getWals := func(wf *gitWalFile) []string {
+		// Force a fetch
+		wf.lastFetch = time.Time{}
+		wals, err := wf.GetMatchingWals(ctx, filepath.Join(wf.GetRoot(), "wal_*.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return wals
+	}
+
+	a, b := newWalFile("a"), newWalFile("b")
+
+	if err := a.Flush(ctx, bytes.NewBufferString("foo"), "1"); err != nil {
+		t.Fatal(err)
+	}
+	// The push from b is initially rejected, as it's behind the upstream
+	if err := b.Flush(ctx, bytes.NewBufferString("bar"), "2"); err != nil {
+		t.Fatal(err)
+	}
+
+	if wals := getWals(a); len(wals) != 2 {
+		t.Fatalf("Expected 2 wals but got %v", wals)
+	}
+	var buf bytes.Buffer
+	if err := a.GetWalBytes(ctx, &buf, "2"); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "bar" {
+		t.Errorf("Expected wal content %q but got %q", "bar", buf.String())
+	}
+
+	if err := a.RemoveWals(ctx, []string{"1", "2"}); err != nil {
+		t.Fatal(err)
+	}
+	if wals := getWals(b); len(wals) != 0 {
+		t.Errorf("Expected no wals but got %v", wals)
+	}
+
+	// Each change is recorded in the history
+	log, err := b.git(ctx, "log", "--oneline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(bytes.Split([]byte(log), []byte("\n"))); n != 3 {
+		t.Errorf("Expected 3 commits but got %d", n)
+	}
+}
@@ -3,11 +3,9 @@ package s3
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"gopkg.in/yaml.v2"
 	"io"
-	"log"
-	"os"
 	"path"
 	"strings"
 
@@ -20,37 +18,25 @@ import (
 )
 
 const (
-	configFileName = "config.yml"
-	walFilePattern = "wal_%v.db" // TODO dedup, as is in service package
+	defaultRegion   = "eu-west-1"
+	walFilePattern  = "wal_%v.db" // TODO dedup, as is in service package
+	blobFilePattern = "blob_%v"   // TODO dedup, as is in service package
 )
 
+// S3Remote configures an S3 (or S3 compatible, e.g. MinIO or Ceph) bucket. If Key and Secret aren't set,
+// credentials are resolved via the AWS SDK default chain: environment variables, then the shared credentials file
+// (using Profile, if set), then the instance role.
 type S3Remote struct {
-	Key    string
-	Secret string
-	Bucket string
-	Prefix string
-}
-
-type Remotes struct {
-	S3 []S3Remote
-}
-
-func GetS3Config(root string) []S3Remote {
-	cfgFile := path.Join(root, configFileName)
-	f, err := os.Open(cfgFile)
-
-	r := Remotes{}
-	if err == nil {
-		decoder := yaml.NewDecoder(f)
-		err = decoder.Decode(&r)
-		if err != nil {
-			//log.Fatalf("main : Parsing File Config : %v", err)
-			// TODO handle with appropriate error message
-			return r.S3
-		}
-		defer f.Close()
-	}
-	return r.S3
+	Key            string
+	Secret         string
+	Profile        string
+	Bucket         string
+	Prefix         string
+	Endpoint       string   // e.g. "http://localhost:9000", defaults to AWS
+	Region         string   // defaults to eu-west-1
+	ForcePathStyle bool     `yaml:"forcePathStyle"` // required by most self-hosted implementations
+	Sync           string   // "push", "pull" or "both" (default)
+	Match          []string // search groups, only matching items are pushed to the remote
 }
 
 type s3WalFile struct {
@@ -64,13 +50,37 @@ type s3WalFile struct {
 	prefix       string
 }
 
-func NewS3WalFile(cfg S3Remote, root string) *s3WalFile {
-	sess, err := session.NewSession(&aws.Config{
-		Region:      aws.String("eu-west-1"),
-		Credentials: credentials.NewStaticCredentials(cfg.Key, cfg.Secret, ""),
+func NewS3WalFile(cfg S3Remote, root string) (*s3WalFile, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("bucket is required")
+	}
+	if (cfg.Key == "") != (cfg.Secret == "") {
+		return nil, errors.New("key and secret must be set together")
+	}
+
+	// The region isn't resolved from the environment or profile, as remotes previously always used the default
+	region := cfg.Region
+	if region == "" {
+		region = defaultRegion
+	}
+	awsCfg := aws.Config{
+		Region:           aws.String(region),
+		S3ForcePathStyle: aws.Bool(cfg.ForcePathStyle),
+	}
+	if cfg.Key != "" {
+		awsCfg.Credentials = credentials.NewStaticCredentials(cfg.Key, cfg.Secret, "")
+	}
+	if cfg.Endpoint != "" {
+		awsCfg.Endpoint = aws.String(cfg.Endpoint)
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            awsCfg,
+		Profile:           cfg.Profile,
+		SharedConfigState: session.SharedConfigEnable,
 	})
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	return &s3WalFile{
@@ -82,7 +92,7 @@ func NewS3WalFile(cfg S3Remote, root string) *s3WalFile {
 		secret:       cfg.Secret,
 		bucket:       cfg.Bucket,
 		prefix:       cfg.Prefix,
-	}
+	}, nil
 }
 
 func (wf *s3WalFile) GetUUID() string {
@@ -96,17 +106,17 @@ func (wf *s3WalFile) GetRoot() string {
 func (wf *s3WalFile) GetMatchingWals(ctx context.Context, matchPattern string) ([]string, error) {
 	fileNames := []string{}
 	// TODO matchPattern isn't actually doing anything atm
+	// Only list wals, as other files (e.g. attachment blobs) are stored under the same prefix
 	resp, err := wf.svc.ListObjectsV2(&s3.ListObjectsV2Input{
 		Bucket: aws.String(wf.bucket),
-		Prefix: aws.String(wf.GetRoot()),
+		Prefix: aws.String(path.Join(wf.GetRoot(), "wal_")),
 	})
 	if err != nil {
-		//exitErrorf("Unable to list items in bucket %q, %v", wf.bucket, err)
 		return fileNames, err
 	}
 
 	for _, item := range resp.Contents {
-		fileNames = append(fileNames, strings.Split(strings.Split(*item.Key, "_")[1], ".")[0])
+		fileNames = append(fileNames, strings.Split(strings.Split(path.Base(*item.Key), "_")[1], ".")[0])
 	}
 	return fileNames, nil
 }
@@ -127,22 +137,14 @@ func (wf *s3WalFile) GetWalBytes(ctx context.Context, w io.Writer, fileName stri
 		// If the file has been removed, skip, as it means another process has already merged
 		// and deleted this one
 
-		if aerr, ok := err.(awserr.Error); ok {
-			switch aerr.Code() {
-			//case "NoSuchKey": // s3.ErrCodeNoSuchKey does not work, aws is missing this error code so we hardwire a string
-			//    return []EventLog{}, nil
-			case s3.ErrCodeNoSuchKey:
-				return nil
-			default:
-				//exitErrorf("Unable to download item %q, %v", fileName, err)
-				// For now, continue silently rather than exiting
-				return err
-			}
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return nil
 		}
+		return err
 	}
 
-	w.Write(b.Bytes())
-	return nil
+	_, err = w.Write(b.Bytes())
+	return err
 }
 
 func (wf *s3WalFile) RemoveWals(ctx context.Context, fileNames []string) error {
@@ -161,19 +163,10 @@ func (wf *s3WalFile) RemoveWals(ctx context.Context, fileNames []string) error {
 		},
 	})
 	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			switch aerr.Code() {
-			//case "NotFound": // s3.ErrCodeNoSuchKey does not work, aws is missing this error code so we hardwire a string
-			//    return nil
-			case s3.ErrCodeNoSuchKey:
-				return nil
-			default:
-				//exitErrorf("Unable to delete objects %q from bucket %q, %v", fileNames, wf.bucket, err)
-				// For now, continue silently rather than exiting
-				return err
-			}
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return nil
 		}
-
+		return err
 	}
 
 	//err = wf.svc.WaitUntilObjectNotExists(&s3.HeadObjectInput{
@@ -203,15 +196,46 @@ func (wf *s3WalFile) Flush(ctx context.Context, b *bytes.Buffer, randomUUID stri
 		//Body:   b,
 		Body: &bCopy,
 	})
+	return err
+}
+
+func (wf *s3WalFile) GetMatchingBlobs(ctx context.Context) ([]string, error) {
+	checksums := []string{}
+	blobPrefix := fmt.Sprintf(path.Join(wf.GetRoot(), blobFilePattern), "")
+	err := wf.svc.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(wf.bucket),
+		Prefix: aws.String(blobPrefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, item := range page.Contents {
+			checksums = append(checksums, strings.TrimPrefix(*item.Key, blobPrefix))
+		}
+		return true
+	})
+	if err != nil {
+		return checksums, err
+	}
+	return checksums, nil
+}
+
+func (wf *s3WalFile) GetBlobBytes(ctx context.Context, w io.Writer, checksum string) error {
+	b := aws.NewWriteAtBuffer([]byte{})
+	_, err := wf.downloader.DownloadWithContext(ctx, b,
+		&s3.GetObjectInput{
+			Bucket: aws.String(wf.bucket),
+			Key:    aws.String(fmt.Sprintf(path.Join(wf.GetRoot(), blobFilePattern), checksum)),
+		})
 	if err != nil {
-		//exitErrorf("Unable to upload %q to %q, %v", fileName, wf.bucket, err)
-		// For now, continue silently rather than exiting
 		return err
 	}
-	return nil
+	_, err = w.Write(b.Bytes())
+	return err
 }
 
-func exitErrorf(msg string, args ...interface{}) {
-	fmt.Fprintf(os.Stderr, msg+"\n", args...)
-	os.Exit(1)
+func (wf *s3WalFile) FlushBlob(ctx context.Context, r io.Reader, checksum string) error {
+	_, err := wf.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket: aws.String(wf.bucket),
+		Key:    aws.String(fmt.Sprintf(path.Join(wf.GetRoot(), blobFilePattern), checksum)),
+		Body:   r,
+	})
+	return err
 }
@@ -0,0 +1,179 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// fakeS3 implements the subset of the S3 API used by s3WalFile, with path style addressing
+type fakeS3 struct {
+	sync.Mutex
+	bucket  string
+	objects map[string][]byte
+}
+
+type listResult struct {
+	XMLName     xml.Name `xml:"ListBucketResult"`
+	Name        string
+	Prefix      string
+	KeyCount    int
+	IsTruncated bool
+	Contents    []struct{ Key string }
+}
+
+type deleteRequest struct {
+	Objects []struct{ Key string } `xml:"Object"`
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	key := strings.TrimPrefix(strings.TrimPrefix(req.URL.Path, "/"+s.bucket), "/")
+	switch {
+	case req.Method == http.MethodGet && key == "":
+		res := listResult{Name: s.bucket, Prefix: req.URL.Query().Get("prefix")}
+		keys := []string{}
+		for k := range s.objects {
+			if strings.HasPrefix(k, res.Prefix) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			res.Contents = append(res.Contents, struct{ Key string }{k})
+		}
+		res.KeyCount = len(keys)
+		xml.NewEncoder(w).Encode(res)
+	case req.Method == http.MethodPost && req.URL.Query().Has("delete"):
+		d := deleteRequest{}
+		if err := xml.NewDecoder(req.Body).Decode(&d); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, o := range d.Objects {
+			delete(s.objects, o.Key)
+		}
+		fmt.Fprint(w, "<DeleteResult></DeleteResult>")
+	case req.Method == http.MethodPut:
+		b, _ := io.ReadAll(req.Body)
+		s.objects[key] = b
+	case req.Method == http.MethodGet:
+		b, exists := s.objects[key]
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, "<Error><Code>NoSuchKey</Code><Message>missing</Message></Error>")
+			return
+		}
+		w.Write(b)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func newTestServer(t *testing.T) (*s3WalFile, *fakeS3) {
+	s := &fakeS3{bucket: "bucket", objects: make(map[string][]byte)}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+
+	wf, err := NewS3WalFile(S3Remote{
+		Key:            "key",
+		Secret:         "secret",
+		Bucket:         s.bucket,
+		Prefix:         "fzn",
+		Endpoint:       srv.URL,
+		ForcePathStyle: true,
+	}, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wf, s
+}
+
+func TestS3WalFile(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Read and write wals", func(t *testing.T) {
+		wf, s := newTestServer(t)
+		pattern := path.Join(wf.GetRoot(), "wal_*.db")
+
+		for i, content := range []string{"foo", "bar"} {
+			if err := wf.Flush(ctx, bytes.NewBufferString(content), fmt.Sprint(i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// Blobs share the prefix, but aren't wals
+		if err := wf.FlushBlob(ctx, strings.NewReader("blob"), "abc"); err != nil {
+			t.Fatal(err)
+		}
+		if _, exists := s.objects["fzn/wal_0.db"]; !exists {
+			t.Fatalf("Expected wals to be stored under the prefix, but got %v", s.objects)
+		}
+
+		wals, err := wf.GetMatchingWals(ctx, pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(wals) != 2 || wals[0] != "0" || wals[1] != "1" {
+			t.Fatalf("Expected 2 wals but got %v", wals)
+		}
+
+		var b bytes.Buffer
+		if err := wf.GetWalBytes(ctx, &b, "1"); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != "bar" {
+			t.Errorf("Expected bar but got %s", b.String())
+		}
+
+		if err := wf.RemoveWals(ctx, []string{"0"}); err != nil {
+			t.Fatal(err)
+		}
+		if wals, err := wf.GetMatchingWals(ctx, pattern); err != nil || len(wals) != 1 {
+			t.Errorf("Expected 1 wal, got %v, %v", wals, err)
+		}
+		if blobs, err := wf.GetMatchingBlobs(ctx); err != nil || len(blobs) != 1 || blobs[0] != "abc" {
+			t.Errorf("Expected the blob to remain, got %v, %v", blobs, err)
+		}
+	})
+	t.Run("Missing wals are skipped", func(t *testing.T) {
+		wf, _ := newTestServer(t)
+		var b bytes.Buffer
+		if err := wf.GetWalBytes(ctx, &b, "missing"); err != nil {
+			t.Errorf("Expected missing wals to be skipped, but got %v", err)
+		}
+		if err := wf.GetBlobBytes(ctx, &b, "missing"); err == nil {
+			t.Errorf("Expected an error for a missing blob")
+		}
+	})
+	t.Run("Region defaults regardless of the environment", func(t *testing.T) {
+		t.Setenv("AWS_REGION", "us-east-1")
+		wf, err := NewS3WalFile(S3Remote{Key: "key", Secret: "secret", Bucket: "bucket"}, t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r := aws.StringValue(wf.svc.Config.Region); r != defaultRegion {
+			t.Errorf("Expected %s but got %s", defaultRegion, r)
+		}
+
+		wf, err = NewS3WalFile(S3Remote{Key: "key", Secret: "secret", Bucket: "bucket", Region: "us-west-2"}, t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r := aws.StringValue(wf.svc.Config.Region); r != "us-west-2" {
+			t.Errorf("Expected us-west-2 but got %s", r)
+		}
+	})
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"sort"
+	"time"
+)
+
+type AgendaBucket int
+
+const (
+	AgendaOverdue AgendaBucket = iota
+	AgendaToday
+	AgendaThisWeek // after today, up to and including Sunday
+	AgendaLater
+)
+
+func (b AgendaBucket) String() string {
+	switch b {
+	case AgendaOverdue:
+		return "Overdue"
+	case AgendaToday:
+		return "Today"
+	case AgendaThisWeek:
+		return "This week"
+	}
+	return "Later"
+}
+
+// AgendaItem is a ListItem with a date parsed from its line
+type AgendaItem struct {
+	ListItem
+	Date time.Time
+}
+
+type AgendaGroup struct {
+	Bucket AgendaBucket
+	Items  []AgendaItem
+}
+
+func getAgendaBucket(date time.Time, today time.Time) AgendaBucket {
+	if date.Before(today) {
+		return AgendaOverdue
+	}
+	if date.Equal(today) {
+		return AgendaToday
+	}
+	// time.Weekday starts on Sunday, whereas weeks end on Sunday
+	daysToSunday := (7 - int(today.Weekday())) % 7
+	if !date.After(today.AddDate(0, 0, daysToSunday)) {
+		return AgendaThisWeek
+	}
+	return AgendaLater
+}
+
+// GetAgenda returns all items with a date in their line (see `parseLineDate`), grouped into buckets relative to
+// now. Empty buckets are omitted. Within each bucket, items are ordered by date, and then by their position in the
+// list.
+func (r *DBListRepo) GetAgenda(now time.Time, showHidden bool) []AgendaGroup {
+	today := startOfDay(now)
+	buckets := make(map[AgendaBucket][]AgendaItem)
+	for node := r.crdt.traverse(nil); node != nil; node = r.crdt.traverse(node) {
+		item, exists := r.listItemCache[node.key]
+		if !exists || (item.IsHidden && !showHidden) {
+			continue
+		}
+		ld, ok := parseLineDate(item.Line())
+		if !ok {
+			continue
+		}
+		b := getAgendaBucket(ld.date, today)
+		buckets[b] = append(buckets[b], AgendaItem{ListItem: *item, Date: ld.date})
+	}
+
+	groups := []AgendaGroup{}
+	for b := AgendaOverdue; b <= AgendaLater; b++ {
+		items, exists := buckets[b]
+		if !exists {
+			continue
+		}
+		sort.SliceStable(items, func(i, j int) bool {
+			return items[i].Date.Before(items[j].Date)
+		})
+		groups = append(groups, AgendaGroup{Bucket: b, Items: items})
+	}
+	return groups
+}
@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Attachment references a content-addressed blob which is stored alongside the WALs in each WalFile
+type Attachment struct {
+	Name     string // the original file name, used when opening the attachment
+	Checksum string // hex encoded sha256 of the content, which is also used as the blob name
+	Size     int64
+}
+
+// BlobWalFile is implemented by WalFiles which are able to store attachment blobs. Blobs are immutable and
+// referenced by their checksum, so they never need to be merged or deleted during `gather`.
+type BlobWalFile interface {
+	GetMatchingBlobs(context.Context) ([]string, error)
+	GetBlobBytes(context.Context, io.Writer, string) error
+	FlushBlob(context.Context, io.Reader, string) error
+}
+
+var errAttachmentsUnsupported = errors.New("local walfile does not support attachments")
+
+// attachmentCacheDirName is the directory within the root to which attachments are retrieved in order to be opened.
+// It's removed on exit.
+const attachmentCacheDirName = "attachments"
+
+func (r *DBListRepo) getAttachmentCacheDir() string {
+	if wf, ok := r.LocalWalFile.(*LocalFileWalFile); ok {
+		return path.Join(wf.GetRoot(), attachmentCacheDirName)
+	}
+	return filepath.Join(os.TempDir(), "fzn_attachments")
+}
+
+func (wf *LocalFileWalFile) GetMatchingBlobs(ctx context.Context) ([]string, error) {
+	paths, err := filepath.Glob(fmt.Sprintf(path.Join(wf.GetRoot(), blobFilePattern), "*"))
+	if err != nil {
+		return []string{}, err
+	}
+	checksums := []string{}
+	for _, p := range paths {
+		_, fileName := path.Split(p)
+		checksums = append(checksums, strings.TrimPrefix(fileName, fmt.Sprintf(blobFilePattern, "")))
+	}
+	return checksums, nil
+}
+
+func (wf *LocalFileWalFile) GetBlobBytes(ctx context.Context, w io.Writer, checksum string) error {
+	f, err := os.Open(fmt.Sprintf(path.Join(wf.GetRoot(), blobFilePattern), checksum))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func (wf *LocalFileWalFile) FlushBlob(ctx context.Context, r io.Reader, checksum string) error {
+	return writeFileAtomic(fmt.Sprintf(path.Join(wf.GetRoot(), blobFilePattern), checksum), r)
+}
+
+// Attachments returns the attachments referenced by the item
+func (i *ListItem) Attachments() []Attachment {
+	attachments := make([]Attachment, len(i.attachments))
+	copy(attachments, i.attachments)
+	return attachments
+}
+
+func (r *DBListRepo) updateAttachments(attachments []Attachment, item *ListItem) EventLog {
+	e := r.newEventLogFromListItem(UpdateEvent, item)
+	e.Attachments = attachments
+	return e
+}
+
+// AddAttachment stores the content as a blob in the local WalFile, and adds a reference to it on the item.
+// The blob is pushed to any remotes which support attachments in the background.
+func (r *DBListRepo) AddAttachment(ctx context.Context, item *ListItem, name string, content io.Reader) error {
+	local, ok := r.LocalWalFile.(BlobWalFile)
+	if !ok {
+		return errAttachmentsUnsupported
+	}
+
+	// The content is spooled to a temporary file, as the checksum (and therefore the blob name) isn't known until
+	// it's been read in full
+	f, err := os.CreateTemp("", "fzn_attachment_*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, h), content)
+	if err != nil {
+		return err
+	}
+	checksum := hex.EncodeToString(h.Sum(nil))
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := local.FlushBlob(ctx, f, checksum); err != nil {
+		return err
+	}
+
+	go func() {
+		for _, wf := range r.getBlobWalFiles() {
+			// Filtered WalFiles receive the blob on the next checkpoint, if the item matches by then
+			if p := r.getWalFilePolicy(wf.(WalFile)); !p.canPush() || p.isFiltered() {
+				continue
+			}
+			// On failure, the attachment event is recorded as unpushed, which forces a checkpoint on the next
+			// gather, where `pushBlobs` retries the blob
+			if err := copyBlob(context.Background(), local, wf, checksum); err != nil {
+				r.syncStatus.recordPush(wf.(WalFile), 1, false, err)
+			}
+		}
+	}()
+
+	attachments := append(item.Attachments(), Attachment{
+		Name:     path.Base(name),
+		Checksum: checksum,
+		Size:     size,
+	})
+	e := r.updateAttachments(attachments, item)
+	ue := r.updateAttachments(item.Attachments(), item)
+
+	r.addEventLog(e)
+	r.addUndoLogs([]EventLog{ue}, []EventLog{e})
+	return nil
+}
+
+// GetAttachment writes the content of the attachment to the writer. Blobs are synced lazily, so if it doesn't
+// exist locally, it's retrieved from the first remote which holds it, and cached in the local WalFile.
+func (r *DBListRepo) GetAttachment(ctx context.Context, a Attachment, w io.Writer) error {
+	local, ok := r.LocalWalFile.(BlobWalFile)
+	if !ok {
+		return errAttachmentsUnsupported
+	}
+
+	err := local.GetBlobBytes(ctx, w, a.Checksum)
+	if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	f, err := os.CreateTemp("", "fzn_attachment_*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	for _, wf := range r.getBlobWalFiles() {
+		if err := f.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		h := sha256.New()
+		if err := wf.GetBlobBytes(ctx, io.MultiWriter(f, h), a.Checksum); err != nil {
+			continue
+		}
+		// Ignore any partial or corrupted blobs
+		if hex.EncodeToString(h.Sum(nil)) != a.Checksum {
+			continue
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if err := local.FlushBlob(ctx, f, a.Checksum); err != nil {
+			return err
+		}
+		return local.GetBlobBytes(ctx, w, a.Checksum)
+	}
+	return fmt.Errorf("unable to retrieve attachment: %s", a.Name)
+}
+
+// copyBlob streams the blob from one BlobWalFile to another, without holding it in memory
+func copyBlob(ctx context.Context, from, to BlobWalFile, checksum string) error {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(from.GetBlobBytes(ctx, pw, checksum))
+	}()
+	err := to.FlushBlob(ctx, pr, checksum)
+	// Unblock the writer if the flush returned before consuming the full blob
+	pr.CloseWithError(err)
+	return err
+}
+
+// getBlobWalFiles returns all owned, non-local WalFiles which support attachments
+func (r *DBListRepo) getBlobWalFiles() []BlobWalFile {
+	r.syncWalFileMut.RLock()
+	defer r.syncWalFileMut.RUnlock()
+	walFiles := []BlobWalFile{}
+	for _, wf := range r.syncWalFiles {
+		if wf == r.LocalWalFile {
+			continue
+		}
+		if bwf, ok := wf.(BlobWalFile); ok {
+			walFiles = append(walFiles, bwf)
+		}
+	}
+	return walFiles
+}
+
+// getReferencedBlobs returns the checksums of all blobs referenced by the events
+func getReferencedBlobs(el []EventLog) map[string]struct{} {
+	referenced := make(map[string]struct{})
+	for _, e := range el {
+		for _, a := range e.Attachments {
+			referenced[a.Checksum] = struct{}{}
+		}
+	}
+	return referenced
+}
+
+// pushBlobs ensures that all locally held blobs which are referenced by live items exist on the remote
+func (r *DBListRepo) pushBlobs(ctx context.Context, wf BlobWalFile, referenced map[string]struct{}) error {
+	local, ok := r.LocalWalFile.(BlobWalFile)
+	if !ok || len(referenced) == 0 {
+		return nil
+	}
+
+	localBlobs, err := local.GetMatchingBlobs(ctx)
+	if err != nil {
+		return err
+	}
+	remoteBlobs, err := wf.GetMatchingBlobs(ctx)
+	if err != nil {
+		return err
+	}
+	remoteBlobMap := make(map[string]struct{})
+	for _, c := range remoteBlobs {
+		remoteBlobMap[c] = struct{}{}
+	}
+
+	for _, c := range localBlobs {
+		if _, isReferenced := referenced[c]; !isReferenced {
+			continue
+		}
+		if _, exists := remoteBlobMap[c]; exists {
+			continue
+		}
+		if err := copyBlob(ctx, local, wf, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -3,12 +3,14 @@ package service
 import (
 	"bytes"
 	"encoding/json"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
@@ -17,6 +19,9 @@ const (
 	webTokensFileName = ".tokens.yml"
 )
 
+// authClient is bounded, as the web loop (which is awaited on exit) authenticates in-line
+var authClient = &http.Client{Timeout: 10 * time.Second}
+
 type WebTokenStore interface {
 	SetEmail(string)
 	SetRefreshToken(string)
@@ -44,7 +49,8 @@ func NewFileWebTokenStore(root string) *FileWebTokenStore {
 	if err == nil {
 		decoder := yaml.NewDecoder(f)
 		err = decoder.Decode(wt)
-		if err != nil {
+		// An empty file holds no tokens
+		if err != nil && err != io.EOF {
 			log.Fatalf("main : Parsing Token File : %v", err)
 			// TODO handle with appropriate error message
 			return wt
@@ -72,13 +78,11 @@ func (wt *FileWebTokenStore) Flush() {
 		log.Fatal(err)
 	}
 
+	// Written atomically, so concurrent processes never read a partially written file
 	tokenFile := path.Join(wt.root, webTokensFileName)
-	f, err := os.Create(tokenFile)
-	if err != nil {
+	if err := writeFileAtomic(tokenFile, bytes.NewReader(b)); err != nil {
 		log.Fatal(err)
 	}
-	defer f.Close()
-	f.Write(b)
 }
 
 type authenticationResultType struct {
@@ -94,7 +98,7 @@ func Authenticate(wt WebTokenStore, args map[string]string) error {
 
 	u, _ := url.Parse(apiURL)
 	u.Path = path.Join(u.Path, "auth")
-	resp, err := http.Post(u.String(), "application/json", bytes.NewBuffer(body))
+	resp, err := authClient.Post(u.String(), "application/json", bytes.NewBuffer(body))
 	if err != nil {
 		return err
 	}
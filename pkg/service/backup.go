@@ -0,0 +1,165 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// BackupDirName is the directory within the root in which snapshots are stored. It's retained on Purge.
+	BackupDirName = "backups"
+
+	backupFilePrefix      = "backup_"
+	backupFileSuffix      = ".db"
+	backupTimestampFormat = "20060102-150405.000"
+
+	// DefaultBackupRetention is the number of snapshots kept, after which the oldest are removed
+	DefaultBackupRetention = 10
+)
+
+// SetBackupRetention sets the number of snapshots to keep. A zero value keeps all snapshots.
+func (r *DBListRepo) SetBackupRetention(n int) {
+	r.backupRetention = n
+}
+
+func getBackupDir(root string) string {
+	return path.Join(root, BackupDirName)
+}
+
+// ListBackups returns the names of the snapshots in the root directory, newest first
+func ListBackups(root string) ([]string, error) {
+	paths, err := filepath.Glob(path.Join(getBackupDir(root), backupFilePrefix+"*"+backupFileSuffix))
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, p := range paths {
+		names = append(names, filepath.Base(p))
+	}
+	// The timestamp format sorts lexically
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	return names, nil
+}
+
+// LoadLocal replays any wals in the LocalWalFile which haven't already been replayed, without starting the sync
+// loops. It's used by commands which operate on the local state and exit (or serve it), rather than starting a
+// client.
+func (r *DBListRepo) LoadLocal(ctx context.Context) error {
+	replayChan := make(chan namedWal)
+	errChan := make(chan error, 1)
+	go func() {
+		var err error
+		for n := range replayChan {
+			if err == nil {
+				if err = r.Replay(n.wal); err == nil && n.name != "" {
+					r.setProcessedWalChecksum(n.name)
+				}
+			}
+		}
+		errChan <- err
+	}()
+	err := r.pull(ctx, []WalFile{r.LocalWalFile}, replayChan)
+	close(replayChan)
+	if replayErr := <-errChan; err == nil {
+		err = replayErr
+	}
+	return err
+}
+
+// backup writes a snapshot of the full current state to the backups directory, and removes the oldest snapshots
+// beyond the retention limit. Snapshots are in the wal format (so the events are compressed), and can be read as
+// any other wal.
+func (r *DBListRepo) backup(now time.Time) (string, error) {
+	wf, ok := r.LocalWalFile.(*LocalFileWalFile)
+	if !ok {
+		return "", errors.New("backups are only supported for file based local walfiles")
+	}
+	dir := getBackupDir(wf.GetRoot())
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", err
+	}
+
+	r.crdt.RLock()
+	el := r.crdt.generateEvents()
+	r.crdt.RUnlock()
+	b, err := BuildByteWal(el)
+	if err != nil {
+		return "", err
+	}
+	name := backupFilePrefix + now.UTC().Format(backupTimestampFormat) + backupFileSuffix
+	if err := writeFileAtomic(path.Join(dir, name), b); err != nil {
+		return "", err
+	}
+
+	if r.backupRetention > 0 {
+		names, err := ListBackups(wf.GetRoot())
+		if err != nil {
+			return "", err
+		}
+		for i := r.backupRetention; i < len(names); i++ {
+			os.Remove(path.Join(dir, names[i]))
+		}
+	}
+	return name, nil
+}
+
+// Backup loads the local state, and writes a snapshot of it to the backups directory, returning the snapshot name
+func (r *DBListRepo) Backup(ctx context.Context) (string, error) {
+	if err := r.LoadLocal(ctx); err != nil {
+		return "", err
+	}
+	return r.backup(time.Now())
+}
+
+// Restore replaces the wals in the local walfile with the snapshot, which is either the name of a file in the
+// backups directory, or a path. A snapshot of the current state is taken beforehand, so restores can be reverted.
+// Restores are refused whilst another process is running against the root directory, as it would flush its own
+// state back on exit.
+//
+// Note that the restored state is merged with any remotes on the next sync, so items created or deleted on remotes
+// since the snapshot will reappear or disappear accordingly. This includes items deleted since the snapshot whose
+// tombstones have been garbage collected (see `tombstone.go`), as no record of the delete remains.
+func (r *DBListRepo) Restore(ctx context.Context, snapshot string) error {
+	wf, ok := r.LocalWalFile.(*LocalFileWalFile)
+	if !ok {
+		return errors.New("backups are only supported for file based local walfiles")
+	}
+	if !r.isLocalLeader() {
+		return errors.New("unable to restore whilst another fzn process is running")
+	}
+	defer r.rootLock.release()
+
+	p := snapshot
+	if !strings.ContainsRune(snapshot, filepath.Separator) {
+		p = path.Join(getBackupDir(wf.GetRoot()), snapshot)
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	// Check the snapshot is valid before removing anything
+	if _, err := r.buildFromFile(bytes.NewReader(b)); err != nil {
+		return fmt.Errorf("invalid snapshot %s: %w", snapshot, err)
+	}
+
+	if _, err := r.Backup(ctx); err != nil {
+		return err
+	}
+
+	names, err := wf.GetMatchingWals(ctx, path.Join(wf.GetRoot(), "wal_*.db"))
+	if err != nil {
+		return err
+	}
+	if err := wf.Flush(ctx, bytes.NewBuffer(b), fmt.Sprintf("%v%v", r.uuid, generateUUID())); err != nil {
+		return err
+	}
+	return wf.RemoveWals(ctx, names)
+}
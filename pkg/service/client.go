@@ -1,8 +1,11 @@
 package service
 
 import (
+	"context"
 	"log"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"time"
@@ -235,6 +238,28 @@ func openURL(url string) error {
 	return exec.Command(cmd, args...).Start()
 }
 
+// OpenAttachment retrieves the attachment into the attachment cache directory, and opens it with the default
+// application
+func (t *ClientBase) OpenAttachment(a Attachment) error {
+	dir := filepath.Join(t.db.getAttachmentCacheDir(), a.Checksum)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	fileName := filepath.Join(dir, filepath.Base(a.Name))
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	if err := t.db.GetAttachment(context.Background(), a, f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return openURL(fileName)
+}
+
 // GetSearchGroupIdxAndOffset returns the group index and offset within that group, respectively.
 // This might have unpredictable results if called on non-search lines (e.g. when CurY != 0)
 func (t *ClientBase) GetSearchGroupIdxAndOffset() (int, int) {
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"path"
+	"sync"
+	"time"
+)
+
+// CompactionConfig dictates how often `gather` writes a full state checkpoint to a remote WalFile (and removes the
+// wals which the checkpoint supersedes). In between checkpoints, changes only reach remotes as the small delta wals
+// written in `flushPartialWals` (local changes) and `flushForwardedWals` (new events pulled from other remotes). A
+// checkpoint is written once any of the thresholds are met. Zero values disable the individual threshold, and a
+// zero-valued CompactionConfig checkpoints on every gather.
+//
+// The LocalWalFile is always checkpointed, as it's the only place that events pulled from remotes are persisted.
+// WalFiles which have failed to receive delta wals are also checkpointed on the next gather.
+type CompactionConfig struct {
+	MaxDeltaWals     int           // max number of wals present in the WalFile
+	MaxDeltaEvents   int           // max number of events pushed or pulled since the last checkpoint
+	MaxCheckpointAge time.Duration // max time since the last checkpoint, if there have been changes since
+}
+
+// DefaultCompactionConfig is used unless overridden by SetCompactionConfig
+var DefaultCompactionConfig = CompactionConfig{
+	MaxDeltaWals:     50,
+	MaxDeltaEvents:   2000,
+	MaxCheckpointAge: time.Hour,
+}
+
+type checkpointState struct {
+	lastCheckpoint time.Time
+	deltaEvents    int
+}
+
+type compactionTracker struct {
+	sync.Mutex
+	cfg    CompactionConfig
+	states map[string]*checkpointState // map[walFileUUID]
+}
+
+func newCompactionTracker(cfg CompactionConfig) *compactionTracker {
+	return &compactionTracker{
+		cfg:    cfg,
+		states: make(map[string]*checkpointState),
+	}
+}
+
+// SetCompactionConfig overrides the DefaultCompactionConfig
+func (r *DBListRepo) SetCompactionConfig(cfg CompactionConfig) {
+	r.compaction.Lock()
+	defer r.compaction.Unlock()
+	r.compaction.cfg = cfg
+}
+
+// recordDeltaEvents increments the count of events which aren't yet represented in a checkpoint, for all WalFiles
+// that have previously been checkpointed (those that haven't are due a checkpoint regardless)
+func (r *DBListRepo) recordDeltaEvents(n int) {
+	r.compaction.Lock()
+	defer r.compaction.Unlock()
+	for _, s := range r.compaction.states {
+		s.deltaEvents += n
+	}
+}
+
+func (r *DBListRepo) setCheckpointed(wf WalFile, t time.Time) {
+	r.compaction.Lock()
+	defer r.compaction.Unlock()
+	r.compaction.states[wf.GetUUID()] = &checkpointState{
+		lastCheckpoint: t,
+	}
+}
+
+// checkpointDue returns whether the WalFile requires a full state checkpoint on this gather. The wal count is only
+// checked if `countWals` is set, and if no other thresholds have been met, as it incurs a list operation on
+// the remote.
+func (r *DBListRepo) checkpointDue(ctx context.Context, wf WalFile, countWals bool) bool {
+	if wf == r.LocalWalFile {
+		return true
+	}
+	// Events in failed delta pushes can only be recovered with a checkpoint
+	if r.syncStatus.hasUnpushedEvents(wf) {
+		return true
+	}
+
+	r.compaction.Lock()
+	cfg := r.compaction.cfg
+	s, exists := r.compaction.states[wf.GetUUID()]
+	var state checkpointState
+	if exists {
+		state = *s
+	}
+	r.compaction.Unlock()
+
+	if !exists || cfg == (CompactionConfig{}) {
+		return true
+	}
+	if cfg.MaxDeltaEvents > 0 && state.deltaEvents >= cfg.MaxDeltaEvents {
+		return true
+	}
+	if cfg.MaxCheckpointAge > 0 && state.deltaEvents > 0 && time.Since(state.lastCheckpoint) >= cfg.MaxCheckpointAge {
+		return true
+	}
+	if countWals && cfg.MaxDeltaWals > 0 {
+		// The checkpoint itself will be one of the files, so we allow for it here
+		if files, err := wf.GetMatchingWals(ctx, path.Join(wf.GetRoot(), "wal_*.db")); err == nil && len(files) > cfg.MaxDeltaWals+1 {
+			return true
+		}
+	}
+	return false
+}
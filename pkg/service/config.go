@@ -7,15 +7,18 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"nhooyr.io/websocket"
 )
 
 type Web struct {
-	client   *http.Client
+	client *http.Client
+	tokens WebTokenStore
+	// The websocket state is managed by the web loop in `startSync`, but is read from other goroutines
+	connLock *sync.RWMutex
 	wsConn   *websocket.Conn
-	tokens   WebTokenStore
 	isActive bool
 }
 
@@ -24,10 +27,42 @@ func NewWeb(webTokens WebTokenStore) *Web {
 		client: &http.Client{
 			Timeout: 3 * time.Second,
 		},
-		tokens: webTokens,
+		tokens:   webTokens,
+		connLock: &sync.RWMutex{},
 	}
 }
 
+func (w *Web) conn() *websocket.Conn {
+	w.connLock.RLock()
+	defer w.connLock.RUnlock()
+	return w.wsConn
+}
+
+func (w *Web) setConn(c *websocket.Conn) {
+	w.connLock.Lock()
+	defer w.connLock.Unlock()
+	w.wsConn = c
+}
+
+func (w *Web) active() bool {
+	w.connLock.RLock()
+	defer w.connLock.RUnlock()
+	return w.isActive
+}
+
+func (w *Web) setActive(isActive bool) {
+	w.connLock.Lock()
+	defer w.connLock.Unlock()
+	w.isActive = isActive
+}
+
+// isConnected returns whether the web remote is active with an established websocket connection
+func (w *Web) isConnected() bool {
+	w.connLock.RLock()
+	defer w.connLock.RUnlock()
+	return w.isActive && w.wsConn != nil
+}
+
 type WebRemote struct {
 	Emails       []string
 	DTLastChange int64
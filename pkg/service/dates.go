@@ -0,0 +1,49 @@
+package service
+
+import (
+	"regexp"
+	"time"
+)
+
+const isoDateFormat = "2006-01-02"
+
+// lineDatePatterns are the date formats recognised in lines, in order of precedence. `dateFormat` is the format
+// inserted by the `{d}` operator.
+var lineDatePatterns = []struct {
+	layout string
+	re     *regexp.Regexp
+}{
+	{dateFormat, regexp.MustCompile(`\b(Mon|Tue|Wed|Thu|Fri|Sat|Sun), (Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec) \d{2}, \d{4}\b`)},
+	{isoDateFormat, regexp.MustCompile(`\b\d{4}-\d{2}-\d{2}\b`)},
+}
+
+// lineDate is a date parsed from a line, along with its location, so it can be replaced in the same format
+type lineDate struct {
+	date       time.Time
+	layout     string
+	start, end int
+}
+
+// parseLineDate returns the first valid date in the line. Dates are returned at midnight in the local timezone.
+func parseLineDate(line string) (lineDate, bool) {
+	for _, p := range lineDatePatterns {
+		for _, loc := range p.re.FindAllStringIndex(line, -1) {
+			d, err := time.ParseInLocation(p.layout, line[loc[0]:loc[1]], time.Local)
+			if err != nil {
+				// e.g. 2022-13-45, or a weekday which doesn't match the date
+				continue
+			}
+			if p.layout == dateFormat && d.Weekday().String()[:3] != line[loc[0]:loc[0]+3] {
+				continue
+			}
+			return lineDate{date: d, layout: p.layout, start: loc[0], end: loc[1]}, true
+		}
+	}
+	return lineDate{}, false
+}
+
+// startOfDay truncates the time to midnight in its timezone
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
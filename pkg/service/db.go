@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"time"
 )
 
 type RefreshKey struct {
@@ -18,6 +19,13 @@ func (e FinishWithPurgeError) Error() string {
 type namedWal struct {
 	name string
 	wal  []EventLog
+	// isCollab is set for wals received via the web remote, which may contain collaborator events, see
+	// `filterCollaboratorEvents`
+	isCollab bool
+	// forward is set for wals received from remotes, so that any events which are new to us are pushed on to the
+	// other WalFiles, see `getUnseenEvents`
+	forward bool
+	source  WalFile // the WalFile the wal was pulled from, which is nil for websocket events
 }
 
 // Start begins push/pull for all WalFiles
@@ -35,11 +43,24 @@ func (r *DBListRepo) Start(client Client) error {
 	// Therefore, we consume client events into a channel, and consume from it in the same loop
 	// as the pull/replay loop.
 	errChan := make(chan error)
+	gcTicker := time.NewTicker(tombstoneGCInterval)
 	go func() {
 		for {
 			select {
+			case <-gcTicker.C:
+				// Run in this loop as it mutates the crdt
+				if pruned := r.collectGarbage(time.Now()); len(pruned) > 0 {
+					r.recordDeltaEvents(len(pruned))
+				}
 			case n := <-replayChan:
 				name, wal := n.name, n.wal
+				if n.isCollab {
+					wal = r.filterCollaboratorEvents(wal)
+				}
+				var unseen []EventLog
+				if n.forward {
+					unseen = r.getUnseenEvents(wal)
+				}
 				if err := r.Replay(wal); err != nil {
 					errChan <- err
 					return
@@ -47,6 +68,17 @@ func (r *DBListRepo) Start(client Client) error {
 				if name != "" {
 					r.setProcessedWalChecksum(name)
 				}
+				// Forward new events to the other WalFiles on the next push, see `flushForwardedWals`
+				if len(unseen) > 0 {
+					f := forwardedWal{
+						wal:    unseen,
+						source: n.source,
+						isWeb:  n.isCollab,
+					}
+					go func() {
+						r.forwardChan <- f
+					}()
+				}
 				changedKeys, allowOverride := getChangedListItemKeysFromWal(wal)
 				go func() {
 					inputEvtsChan <- RefreshKey{
@@ -66,6 +98,8 @@ func (r *DBListRepo) Start(client Client) error {
 				if err := client.HandleEvent(ev); err != nil {
 					cancel()
 					<-r.finalFlushChan
+					// Wait for any in-flight web registration, which may flush tokens to the root directory
+					<-r.webLoopDone
 					_, isPurge := err.(FinishWithPurgeError)
 					if finishErr := r.finish(isPurge); finishErr != nil {
 						errChan <- finishErr
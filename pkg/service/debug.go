@@ -35,7 +35,7 @@ func (r *DBListRepo) DebugWriteEventsToFile(filename string, key string) {
 
 	for _, e := range n.wal {
 		if e.ListItemKey == key {
-			f.WriteString(fmt.Sprintf("[%s] [%s] [%s] [%v]\n", eventNameMap[e.EventType], e.key(), e.Line, e.Friends.Emails))
+			f.WriteString(fmt.Sprintf("[%s] [%s] [device %d] [%s] [%v]\n", eventNameMap[e.EventType], e.key(), e.DeviceID, e.Line, e.Friends.Emails))
 		}
 	}
 }
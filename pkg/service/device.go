@@ -0,0 +1,69 @@
+package service
+
+import (
+	"os"
+	"path"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	deviceFileName = ".device.yml"
+)
+
+// Device identifies the machine. It's persisted in the root directory, so it's shared by all processes running against
+// the root (and by all machines syncing the root via e.g. Dropbox). Events record the device they were generated on
+// (see `EventLog.DeviceID`), for provenance and tie-breaking in `checkEquality`. It can't be used as the origin of
+// events (see `EventLog.UUID`) though, which must be unique per process for item keys. The Name defaults to the
+// hostname, but can be edited by hand. Names are shared with other devices (and collaborators) via AckEvents.
+type Device struct {
+	ID   uuid   `yaml:"id"`
+	Name string `yaml:"name"`
+}
+
+// getOrCreateDevice reads the Device from the root directory, generating and persisting a new one if it doesn't
+// exist (or can't be parsed)
+func getOrCreateDevice(root string) (Device, error) {
+	deviceFile := path.Join(root, deviceFileName)
+	if b, err := os.ReadFile(deviceFile); err == nil {
+		d := Device{}
+		if err := yaml.Unmarshal(b, &d); err == nil && d.ID != 0 {
+			return d, nil
+		}
+	}
+
+	name, _ := os.Hostname()
+	d := Device{
+		ID:   generateUUID(),
+		Name: name,
+	}
+	b, err := yaml.Marshal(&d)
+	if err != nil {
+		return d, err
+	}
+	return d, os.WriteFile(deviceFile, b, 0644)
+}
+
+// Device returns the identity of the current device
+func (r *DBListRepo) Device() Device {
+	return r.device
+}
+
+// DeviceName returns the name of the device with the given ID, which is known once the device has emitted an ack,
+// or an empty string otherwise
+func (r *DBListRepo) DeviceName(id uuid) string {
+	if id == r.device.ID {
+		return r.device.Name
+	}
+	r.crdt.RLock()
+	defer r.crdt.RUnlock()
+	return r.crdt.ackEventSet[id].Line
+}
+
+// LastEditedOn returns the name of the device the item was last edited on, if known
+func (r *DBListRepo) LastEditedOn(item *ListItem) string {
+	if item.lastEditedOn == 0 {
+		return ""
+	}
+	return r.DeviceName(item.lastEditedOn)
+}
@@ -7,9 +7,10 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/binary"
-	"encoding/gob"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"math/rand"
 	"net/url"
@@ -20,6 +21,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"nhooyr.io/websocket"
@@ -30,7 +32,7 @@ func init() {
 }
 
 // IMPORTANT: bump cloud version
-const LatestWalSchemaID uint16 = 7
+const LatestWalSchemaID uint16 = 8
 
 // sync intervals
 const (
@@ -42,7 +44,7 @@ const (
 )
 
 func generateUUID() uuid {
-	return uuid(rand.Uint32())
+	return uuid(rand.Uint64())
 }
 
 type EventType uint16
@@ -58,8 +60,13 @@ const (
 	HideEvent
 	DeleteEvent
 	PositionEvent
+	AckEvent // see `tombstone.go`
 )
 
+// readOnlyFriendSuffix can be appended to the email in a friend config line to grant read-only access, e.g.
+// `fzn_cfg:friend joe@bloggs.com:ro @me@example.com`
+const readOnlyFriendSuffix = ":ro"
+
 type LineFriends struct {
 	IsProcessed bool
 	Offset      int
@@ -68,27 +75,33 @@ type LineFriends struct {
 }
 
 type EventLog struct {
-	UUID                           uuid // origin UUID
-	LamportTimestamp               int64
+	UUID                           uuid  // origin UUID
+	LamportTimestamp               int64 // a hybrid logical clock since schema v8 (see `hlc.go`)
 	EventType                      EventType
 	ListItemKey, TargetListItemKey string
 	Line                           string
 	Note                           []byte
 	IsHidden                       bool
 	Friends                        LineFriends
+	Attachments                    []Attachment
+	AuthorEmail                    string // the email of the user who generated the event, if logged in
+	DeviceID                       uuid   // the device on which the event was generated, see `Device`
 	cachedKey                      string
 }
 
 func (r *DBListRepo) newEventLog(t EventType) EventLog {
 	return EventLog{
 		UUID:             r.uuid,
-		LamportTimestamp: r.currentLamportTimestamp,
+		LamportTimestamp: r.clock.next(),
 		EventType:        t,
+		AuthorEmail:      r.email,
+		DeviceID:         r.device.ID,
 	}
 }
 
 func (r *DBListRepo) newEventLogFromListItem(t EventType, item *ListItem) EventLog {
 	e := r.newEventLog(t)
+	e.LamportTimestamp = r.nextItemTimestamp(item.key)
 	e.ListItemKey = item.key
 	if item.matchChild != nil {
 		e.TargetListItemKey = item.matchChild.key
@@ -96,12 +109,13 @@ func (r *DBListRepo) newEventLogFromListItem(t EventType, item *ListItem) EventL
 	e.Line = item.rawLine
 	e.Note = item.Note
 	e.IsHidden = item.IsHidden
+	e.Attachments = item.attachments
 	return e
 }
 
 func (e *EventLog) key() string {
 	if e.cachedKey == "" {
-		e.cachedKey = strconv.Itoa(int(e.UUID)) + ":" + strconv.Itoa(int(e.LamportTimestamp))
+		e.cachedKey = strconv.FormatUint(uint64(e.UUID), 10) + ":" + strconv.FormatInt(e.LamportTimestamp, 10)
 	}
 	return e.cachedKey
 }
@@ -143,10 +157,20 @@ func NewLocalFileWalFile(rootDir string) *LocalFileWalFile {
 	}
 }
 
+// Purge removes everything in the root directory other than the backups, so a purge can be reverted via Restore
 func (wf *LocalFileWalFile) Purge() {
-	if err := os.RemoveAll(wf.rootDir); err != nil {
+	entries, err := os.ReadDir(wf.rootDir)
+	if err != nil && !os.IsNotExist(err) {
 		log.Fatal(err)
 	}
+	for _, e := range entries {
+		if e.Name() == BackupDirName {
+			continue
+		}
+		if err := os.RemoveAll(path.Join(wf.rootDir, e.Name())); err != nil {
+			log.Fatal(err)
+		}
+	}
 	os.Exit(0)
 }
 
@@ -177,8 +201,13 @@ func (wf *LocalFileWalFile) GetWalBytes(ctx context.Context, w io.Writer, fileNa
 	fileName = fmt.Sprintf(path.Join(wf.GetRoot(), walFilePattern), fileName)
 	f, err := os.Open(fileName)
 	if err != nil {
-		return nil
+		// The wal has been merged and removed by another process
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
 	}
+	defer f.Close()
 	if _, err := io.Copy(w, f); err != nil {
 		return err
 	}
@@ -198,15 +227,68 @@ func (wf *LocalFileWalFile) RemoveWals(ctx context.Context, fileNames []string)
 
 func (wf *LocalFileWalFile) Flush(ctx context.Context, b *bytes.Buffer, randomUUID string) error {
 	fileName := fmt.Sprintf(path.Join(wf.GetRoot(), walFilePattern), randomUUID)
-	f, err := os.Create(fileName)
+	return writeFileAtomic(fileName, bytes.NewReader(b.Bytes()))
+}
+
+// Temporary files are hidden, and suffixed, so they're never matched as wals or blobs
+const (
+	tempFilePrefix = "."
+	tempFileSuffix = ".tmp"
+
+	// staleTempFileAge is the age after which temporary files are assumed to be left over from a crash, rather than
+	// being written by another process. It's generous, as large attachments may take some time to write.
+	staleTempFileAge = time.Hour
+)
+
+// writeFileAtomic writes to a temporary file in the same directory, which is synced to disk, and renamed to the
+// final name once complete. Readers (including other processes) therefore never see partially written files. The
+// directory is synced after the rename, so the file persists across a crash.
+func writeFileAtomic(fileName string, r io.Reader) error {
+	dir, base := filepath.Split(fileName)
+	// Unique temporary names prevent clobbering by concurrent writes to the same file (e.g. identical blobs)
+	f, err := os.CreateTemp(dir, tempFilePrefix+base+".*"+tempFileSuffix)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	if _, err := f.Write(b.Bytes()); err != nil {
+	tmp := f.Name()
+	// CreateTemp creates files with 0600, whereas files are otherwise created with 0644
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		os.Remove(tmp)
 		return err
 	}
-	return nil
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, fileName); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return syncDir(dir)
+}
+
+// removeStaleTempFiles removes temporary files left over from writes which were interrupted before being renamed
+func (wf *LocalFileWalFile) removeStaleTempFiles(now time.Time) {
+	paths, err := filepath.Glob(path.Join(wf.GetRoot(), tempFilePrefix+"*"+tempFileSuffix))
+	if err != nil {
+		return
+	}
+	for _, p := range paths {
+		if fi, err := os.Stat(p); err == nil && now.Sub(fi.ModTime()) >= staleTempFileAge {
+			os.Remove(p)
+		}
+	}
 }
 
 // https://go.dev/play/p/1kbFF8FR-V7
@@ -302,12 +384,130 @@ func (r *DBListRepo) getEmailFromConfigLine(line string) string {
 	// Avoiding expensive regex based ops for now
 	var f string
 	if words, isConfig := r.checkIfConfigLine(line); isConfig {
-		f = strings.ToLower(words[1])
+		f, _ = parseConfigFriend(words[1])
 	}
 	return f
 
 }
 
+// parseConfigFriend returns the lower-cased email from the friend portion of a config line, and whether or not the
+// friend has been granted read-only access
+func parseConfigFriend(word string) (string, bool) {
+	email := strings.ToLower(word)
+	if strings.HasSuffix(email, readOnlyFriendSuffix) {
+		return strings.TrimSuffix(email, readOnlyFriendSuffix), true
+	}
+	return email, false
+}
+
+// updateReadOnlyFriends tracks which config lines grant read-only access, along with the timestamp of the event which
+// granted it. The access mode can change without the email changing, so this is handled separately to the main
+// friends cache.
+func (r *DBListRepo) updateReadOnlyFriends(e EventLog, existingLine string) {
+	r.friendsUpdateLock.Lock()
+	defer r.friendsUpdateLock.Unlock()
+
+	if before := r.getEmailFromConfigLine(existingLine); before != "" {
+		delete(r.readOnlyFriends[before], e.ListItemKey)
+		if len(r.readOnlyFriends[before]) == 0 {
+			delete(r.readOnlyFriends, before)
+		}
+	}
+
+	if e.EventType == DeleteEvent {
+		return
+	}
+
+	if words, isConfig := r.checkIfConfigLine(e.Line); isConfig {
+		if email, isReadOnly := parseConfigFriend(words[1]); isReadOnly {
+			if _, exists := r.readOnlyFriends[email]; !exists {
+				r.readOnlyFriends[email] = make(map[string]int64)
+			}
+			r.readOnlyFriends[email][e.ListItemKey] = e.LamportTimestamp
+		}
+	}
+}
+
+// friendIsReadOnly returns true if all config lines for the friend grant read-only access. If any of them grant
+// full access, full access wins.
+func (r *DBListRepo) friendIsReadOnly(email string) bool {
+	_, isReadOnly := r.friendReadOnlySince(email)
+	return isReadOnly
+}
+
+// friendReadOnlySince returns the timestamp from which the friend has been read-only (that of the most recent config
+// line granting read-only access), and whether they're read-only at all
+func (r *DBListRepo) friendReadOnlySince(email string) (int64, bool) {
+	r.friendsUpdateLock.RLock()
+	defer r.friendsUpdateLock.RUnlock()
+	readOnlyItems := r.readOnlyFriends[email]
+	if len(readOnlyItems) == 0 || len(readOnlyItems) < len(r.friends[email]) {
+		return 0, false
+	}
+	var since int64
+	for _, ts := range readOnlyItems {
+		if ts > since {
+			since = ts
+		}
+	}
+	return since, true
+}
+
+// filterCollaboratorEvents removes the events which collaborators aren't permitted to make. It's applied to wals
+// received via the web remote (the only route by which collaborator events arrive) as they're pulled, rather than on
+// replay, so the accepted state never depends on the order in which config changes are replayed, and events
+// accepted whilst a friend had full access are retained.
+//
+// Events made after a friend became read-only are rejected if they're attributed to the friend, or if they're
+// unattributed (or attributed to anyone other than the owner or a full access friend) and operate on an item shared
+// with the friend.
+//
+// Read-only access is advisory only. Events aren't signed, and `AuthorEmail` is set by the sender, so a collaborator
+// is able to bypass the filter by attributing their events to the owner (or to a full access friend). Events pulled
+// from other remotes aren't filtered either, as those are only written to by the owner's own devices.
+func (r *DBListRepo) filterCollaboratorEvents(el []EventLog) []EventLog {
+	r.friendsUpdateLock.RLock()
+	readOnlyEmails := []string{}
+	for email := range r.readOnlyFriends {
+		readOnlyEmails = append(readOnlyEmails, email)
+	}
+	r.friendsUpdateLock.RUnlock()
+	if len(readOnlyEmails) == 0 {
+		return el
+	}
+
+	isPermitted := func(e EventLog) bool {
+		if e.AuthorEmail == r.email && r.email != "" {
+			return true
+		}
+		if since, isReadOnly := r.friendReadOnlySince(e.AuthorEmail); isReadOnly {
+			return e.LamportTimestamp < since
+		}
+		if _, isFriend := r.friends[e.AuthorEmail]; isFriend {
+			return true
+		}
+		for _, email := range readOnlyEmails {
+			if since, isReadOnly := r.friendReadOnlySince(email); isReadOnly && e.LamportTimestamp >= since &&
+				r.itemIsSharedWith(e.ListItemKey, email) {
+				return false
+			}
+		}
+		return true
+	}
+
+	filteredWal := []EventLog{}
+	for _, e := range el {
+		switch e.EventType {
+		case UpdateEvent, DeleteEvent, PositionEvent:
+			if !isPermitted(e) {
+				continue
+			}
+		}
+		filteredWal = append(filteredWal, e)
+	}
+	return filteredWal
+}
+
 func (r *DBListRepo) repositionActiveFriends(e EventLog) EventLog {
 	if len(e.Line) == 0 {
 		return e
@@ -340,6 +540,20 @@ func (r *DBListRepo) repositionActiveFriends(e EventLog) EventLog {
 			e.Friends.Offset = len(e.Line)
 			return e
 		}
+		// The local user is implicitly a collaborator on any line they share. This allows collaborators to
+		// route their own changes on the line back to the owner (see `getMatchedWal`)
+		if r.email != "" {
+			isIncluded := false
+			for _, f := range friends {
+				if strings.ToLower(f) == r.email {
+					isIncluded = true
+					break
+				}
+			}
+			if !isIncluded {
+				friends = append(friends, r.email)
+			}
+		}
 	}
 
 	newLine := e.Line
@@ -385,6 +599,11 @@ func (r *DBListRepo) generateFriendChangeEvents(e EventLog, item *ListItem) {
 		existingLine = item.rawLine
 	}
 
+	switch e.EventType {
+	case AddEvent, UpdateEvent, DeleteEvent:
+		r.updateReadOnlyFriends(e, existingLine)
+	}
+
 	before := r.getEmailFromConfigLine(existingLine)
 	switch e.EventType {
 	case AddEvent, UpdateEvent:
@@ -479,8 +698,37 @@ func (a *EventLog) before(b EventLog) bool {
 	return leftEventOlder == checkEquality(*a, b)
 }
 
+// getUnseenEvents returns the events which will change the state when processed, i.e. those which aren't older
+// than, or duplicates of, the events already processed. Only these are forwarded between remotes, so events
+// echoed back by other devices aren't forwarded indefinitely.
+func (r *DBListRepo) getUnseenEvents(el []EventLog) []EventLog {
+	unseen := []EventLog{}
+	for _, e := range el {
+		var ce EventLog
+		var exists bool
+		switch e.EventType {
+		case UpdateEvent:
+			ce, exists = r.crdt.addEventSet[e.ListItemKey]
+		case DeleteEvent:
+			ce, exists = r.crdt.deleteEventSet[e.ListItemKey]
+		case PositionEvent:
+			ce, exists = r.crdt.positionEventSet[e.ListItemKey]
+		case AckEvent:
+			ce, exists = r.crdt.ackEventSet[eventDevice(e)]
+		default:
+			continue
+		}
+		if exists && (e.before(ce) || checkEquality(e, ce) == eventsEqual) {
+			continue
+		}
+		unseen = append(unseen, e)
+	}
+	return unseen
+}
+
 func (r *DBListRepo) processEventLog(e EventLog) (*ListItem, error) {
-	item := r.getOrCreateListItem(e.ListItemKey)
+	r.crdt.Lock()
+	defer r.crdt.Unlock()
 
 	var eventCache map[string]EventLog
 	switch e.EventType {
@@ -490,11 +738,25 @@ func (r *DBListRepo) processEventLog(e EventLog) (*ListItem, error) {
 		eventCache = r.crdt.deleteEventSet
 	case PositionEvent:
 		eventCache = r.crdt.positionEventSet
+	case AckEvent:
+		// AckEvents aren't associated with an item, and their timestamps are intentionally behind the clock, so
+		// they don't contribute to it
+		r.crdt.ack(e)
+		return nil, nil
+	default:
+		// Ignore event types from future versions
+		return r.listItemCache[e.ListItemKey], nil
 	}
 
-	// Check the event cache and skip if the event is older than the most-recently processed
+	r.crdt.observe(e)
+
+	item := r.getOrCreateListItem(e.ListItemKey)
+
+	// Check the event cache and skip if the event is older than the most-recently processed.
+	// We also skip exact duplicates, as events shared with collaborators can be echoed back with remapped
+	// targets (see `getSharedEvent`), which must not override the original.
 	if ce, exists := eventCache[e.ListItemKey]; exists {
-		if e.before(ce) {
+		if e.before(ce) || checkEquality(e, ce) == eventsEqual {
 			return item, nil
 		}
 	}
@@ -502,10 +764,7 @@ func (r *DBListRepo) processEventLog(e EventLog) (*ListItem, error) {
 	// Add the event to the cache after the pre-existence checks above
 	eventCache[e.ListItemKey] = e
 
-	// Local lamport timestamp is ONLY incremented here
-	if r.currentLamportTimestamp <= e.LamportTimestamp {
-		r.currentLamportTimestamp = e.LamportTimestamp + 1
-	}
+	r.clock.observe(e.LamportTimestamp)
 
 	r.generateFriendChangeEvents(e, item)
 
@@ -527,6 +786,10 @@ func updateItemFromEvent(item *ListItem, e EventLog, email string) error {
 	item.rawLine = e.Line
 	item.Note = e.Note
 	item.IsHidden = e.IsHidden
+	item.attachments = e.Attachments
+	item.lastEditedBy = e.AuthorEmail
+	item.lastEditedOn = e.DeviceID
+	item.lastEditedAt = e.LamportTimestamp
 
 	// item.friends.emails is a map, which we only ever want to OR with to aggregate
 	mergedEmailMap := make(map[string]struct{})
@@ -579,6 +842,12 @@ func BuildFromFileTreeSchema(walSchemaVersionID uint16, raw io.Reader) ([]EventL
 		}
 	}
 
+	// Versions >=8 are streamed record by record (see wal.go), rather than decoded as a single gob blob
+	if walSchemaVersionID >= 8 {
+		el, err := decodeWal(raw)
+		return el, walSchemaVersionID, err
+	}
+
 	var el []EventLog
 	pr, pw := io.Pipe()
 	errChan := make(chan error, 1)
@@ -599,11 +868,8 @@ func BuildFromFileTreeSchema(walSchemaVersionID uint16, raw io.Reader) ([]EventL
 
 	switch walSchemaVersionID {
 	case 7:
-		dec := gob.NewDecoder(pr)
-		if err := dec.Decode(&el); err != nil {
-			return el, walSchemaVersionID, err
-		}
-		if err := <-errChan; err != nil {
+		var err error
+		if el, err = legacyMigrateFromVersionSeven(pr, errChan); err != nil {
 			return el, walSchemaVersionID, err
 		}
 	}
@@ -634,12 +900,25 @@ const (
 	rightEventOlder
 )
 
+// checkEquality orders events by timestamp. Ties are broken by the (stable) device, and then by the origin, which
+// distinguishes processes on the same device. Events without a device (prior to schema v8) order first.
 func checkEquality(event1 EventLog, event2 EventLog) int {
-	if event1.LamportTimestamp < event2.LamportTimestamp ||
-		event1.LamportTimestamp == event2.LamportTimestamp && event1.UUID < event2.UUID {
-		return leftEventOlder
-	} else if event2.LamportTimestamp < event1.LamportTimestamp ||
-		event2.LamportTimestamp == event1.LamportTimestamp && event2.UUID < event1.UUID {
+	if event1.LamportTimestamp != event2.LamportTimestamp {
+		if event1.LamportTimestamp < event2.LamportTimestamp {
+			return leftEventOlder
+		}
+		return rightEventOlder
+	}
+	if event1.DeviceID != event2.DeviceID {
+		if event1.DeviceID < event2.DeviceID {
+			return leftEventOlder
+		}
+		return rightEventOlder
+	}
+	if event1.UUID != event2.UUID {
+		if event1.UUID < event2.UUID {
+			return leftEventOlder
+		}
 		return rightEventOlder
 	}
 	return eventsEqual
@@ -729,6 +1008,20 @@ func (r *DBListRepo) setProcessedWalChecksum(checksum string) {
 	r.processedWalChecksums[checksum] = struct{}{}
 }
 
+func (r *DBListRepo) setPushedWal(name string) {
+	r.processedWalChecksumLock.Lock()
+	defer r.processedWalChecksumLock.Unlock()
+	r.processedWalChecksums[name] = struct{}{}
+	r.pushedWals[name] = struct{}{}
+}
+
+func (r *DBListRepo) isWalPushed(name string) bool {
+	r.processedWalChecksumLock.Lock()
+	defer r.processedWalChecksumLock.Unlock()
+	_, exists := r.pushedWals[name]
+	return exists
+}
+
 func (r *DBListRepo) isWalChecksumProcessed(checksum string) bool {
 	r.processedWalChecksumLock.Lock()
 	defer r.processedWalChecksumLock.Unlock()
@@ -737,22 +1030,45 @@ func (r *DBListRepo) isWalChecksumProcessed(checksum string) bool {
 }
 
 func (r *DBListRepo) pull(ctx context.Context, walFiles []WalFile, replayChan chan namedWal) error {
+	_, err := r.pullAll(ctx, walFiles, replayChan)
+	return err
+}
+
+// walFetchError wraps errors encountered when retrieving wals from a WalFile, to distinguish them from incompatible
+// wals during the parse
+type walFetchError struct {
+	err error
+}
+
+func (e walFetchError) Error() string {
+	return e.err.Error()
+}
+
+// pullAll pulls from the walFiles, and additionally returns whether all wals were successfully retrieved
+func (r *DBListRepo) pullAll(ctx context.Context, walFiles []WalFile, replayChan chan namedWal) (bool, error) {
 	type wfWalPair struct {
 		wf      WalFile
 		newWals []string
 	}
 
+	var incomplete int32
 	nameChan := make(chan wfWalPair)
 	go func() {
 		var wg sync.WaitGroup
 		for _, wf := range walFiles {
+			// Skip remotes which are backing off following errors
+			if !r.syncStatus.shouldAttempt(wf) {
+				atomic.StoreInt32(&incomplete, 1)
+				continue
+			}
 			wg.Add(1)
 			go func(wf WalFile) {
 				defer wg.Done()
 				filePathPattern := path.Join(wf.GetRoot(), "wal_*.db")
 				newWals, err := wf.GetMatchingWals(ctx, filePathPattern)
 				if err != nil {
-					//log.Fatal(err)
+					atomic.StoreInt32(&incomplete, 1)
+					r.syncStatus.recordPull(wf, newRemoteError(wf, RemoteOpList, err))
 					return
 				}
 				nameChan <- wfWalPair{wf, newWals}
@@ -766,40 +1082,50 @@ func (r *DBListRepo) pull(ctx context.Context, walFiles []WalFile, replayChan ch
 	for n := range nameChan {
 		wf := n.wf
 		newWals := n.newWals
+		var fetchErr error
 		for _, newWal := range newWals {
 			if !r.isWalChecksumProcessed(newWal) {
 				pr, pw := io.Pipe()
 				go func() {
-					defer pw.Close()
 					if err := wf.GetWalBytes(ctx, pw, newWal); err != nil {
-						// TODO handle
-						//log.Fatal(err)
+						pw.CloseWithError(walFetchError{newRemoteError(wf, RemoteOpGet, err)})
+						return
 					}
+					pw.Close()
 				}()
 
 				// Build new wals
 				newWfWal, err := r.buildFromFile(pr)
 				if err != nil {
+					if fe := (walFetchError{}); errors.As(err, &fe) {
+						atomic.StoreInt32(&incomplete, 1)
+						fetchErr = fe.err
+					}
 					// Ignore incompatible files
 					continue
 				}
 
 				if len(newWfWal) > 0 {
+					_, isCollab := wf.(*WebWalFile)
 					wg.Add(1)
 					go func(n string, wal []EventLog) {
 						defer wg.Done()
 						replayChan <- namedWal{
-							name: n,
-							wal:  wal,
+							name:     n,
+							wal:      wal,
+							isCollab: isCollab,
+							forward:  wf != r.LocalWalFile,
+							source:   wf,
 						}
 					}(newWal, newWfWal)
 				}
 			}
 		}
+		r.syncStatus.recordPull(wf, fetchErr)
 	}
 	wg.Wait()
 
-	return nil
+	return atomic.LoadInt32(&incomplete) == 0, nil
 }
 
 func (r *DBListRepo) gather(ctx context.Context) error {
@@ -807,26 +1133,54 @@ func (r *DBListRepo) gather(ctx context.Context) error {
 	// Create a new list so we don't have to keep the lock on the mutex for too long
 	r.syncWalFileMut.RLock()
 	r.allWalFileMut.RLock()
-	ownedWalFiles := []WalFile{}
-	nonOwnedWalFiles := []WalFile{}
+	candidateOwnedWalFiles := []WalFile{}
+	candidateNonOwnedWalFiles := []WalFile{}
 	for _, wf := range r.syncWalFiles {
-		ownedWalFiles = append(ownedWalFiles, wf)
+		candidateOwnedWalFiles = append(candidateOwnedWalFiles, wf)
 	}
 	for k, wf := range r.allWalFiles {
 		if _, exists := r.syncWalFiles[k]; !exists {
-			nonOwnedWalFiles = append(nonOwnedWalFiles, wf)
+			candidateNonOwnedWalFiles = append(candidateNonOwnedWalFiles, wf)
 		}
 	}
 	r.syncWalFileMut.RUnlock()
 	r.allWalFileMut.RUnlock()
 
+	// Only write full state checkpoints to those walfiles which are due one (see `CompactionConfig`). Others will
+	// have already received the changes via the delta wals in `flushPartialWals`.
+	ownedWalFiles := []WalFile{}
+	nonOwnedWalFiles := []WalFile{}
+	for _, wf := range candidateOwnedWalFiles {
+		if !r.getWalFilePolicy(wf).canPush() {
+			continue
+		}
+		// Other processes sharing the root directory may not have pulled the local wals yet (see `rootLock`)
+		if wf == r.LocalWalFile && !r.isLocalLeader() {
+			continue
+		}
+		if r.syncStatus.shouldAttempt(wf) && r.checkpointDue(ctx, wf, true) {
+			ownedWalFiles = append(ownedWalFiles, wf)
+		}
+	}
+	for _, wf := range candidateNonOwnedWalFiles {
+		if r.syncStatus.shouldAttempt(wf) && r.checkpointDue(ctx, wf, false) {
+			nonOwnedWalFiles = append(nonOwnedWalFiles, wf)
+		}
+	}
+	if len(ownedWalFiles) == 0 && len(nonOwnedWalFiles) == 0 {
+		return nil
+	}
+	checkpointTime := time.Now()
+
 	// DANGER: running a pull here can cause map contention (concurrent iteration and write) in the
 	// crdt caches, namely `positionEventSet` in `generateEvents`
 	//if err := r.pull(ctx, ownedWalFiles, replayChan); err != nil {
 	//return err
 	//}
 
+	r.crdt.RLock()
 	fullWal := r.crdt.generateEvents()
+	r.crdt.RUnlock()
 
 	fullByteWal, err := BuildByteWal(fullWal)
 	if err != nil {
@@ -835,15 +1189,41 @@ func (r *DBListRepo) gather(ctx context.Context) error {
 
 	var wg sync.WaitGroup
 	for _, wf := range ownedWalFiles {
+		// Filtered WalFiles receive a subset of the full state, which is built in `push`
+		el, byteWal := []EventLog{}, fullByteWal
+		if p := r.getWalFilePolicy(wf); p.isFiltered() {
+			r.crdt.RLock()
+			el, byteWal = r.getPolicyWal(fullWal, p), nil
+			r.crdt.RUnlock()
+		}
+
 		wg.Add(1)
 		go func(wf WalFile) {
 			defer wg.Done()
 
+			var blobErr error
+			if bwf, ok := wf.(BlobWalFile); ok && wf != r.LocalWalFile {
+				// Ensure the blobs referenced by live items exist on all remotes that support them
+				referenced := el
+				if byteWal != nil {
+					referenced = fullWal
+				}
+				blobErr = r.pushBlobs(ctx, bwf, getReferencedBlobs(referenced))
+			}
+
 			name := fmt.Sprintf("%v%v", r.uuid, generateUUID())
-			err := r.push(ctx, wf, []EventLog{}, fullByteWal, name)
+			err := r.push(ctx, wf, el, byteWal, name)
+			if err == nil && blobErr != nil {
+				// The checkpoint references blobs which the remote doesn't hold, so the events remain unpushed,
+				// which forces another checkpoint (and blob push) on the next gather
+				r.syncStatus.recordPush(wf, 1, false, blobErr)
+			} else {
+				r.syncStatus.recordPush(wf, 0, true, err)
+			}
 			if err != nil {
 				return
 			}
+			r.setCheckpointed(wf, checkpointTime)
 
 			// TODO dedup from `pull` call above
 			// retrieve list of files to delete
@@ -853,15 +1233,21 @@ func (r *DBListRepo) gather(ctx context.Context) error {
 				return
 			}
 
+			// Filtered checkpoints only hold a subset of the state, so they only supersede the wals we pushed
+			// ourselves. Those from other devices may hold events for items which don't match the policy.
+			isFiltered := r.getWalFilePolicy(wf).isFiltered()
 			for _, f := range allFiles {
-				if f != name && r.isWalChecksumProcessed(f) {
-					filesToDelete = append(filesToDelete, f)
+				if f == name || !r.isWalChecksumProcessed(f) || (isFiltered && !r.isWalPushed(f)) {
+					continue
 				}
+				filesToDelete = append(filesToDelete, f)
 			}
 
 			// Schedule a delete on the files
 			if len(filesToDelete) > 0 {
-				wf.RemoveWals(ctx, filesToDelete)
+				if err := wf.RemoveWals(ctx, filesToDelete); err != nil {
+					r.syncStatus.recordError(wf, newRemoteError(wf, RemoteOpRemove, err))
+				}
 			}
 		}(wf)
 	}
@@ -876,9 +1262,12 @@ func (r *DBListRepo) gather(ctx context.Context) error {
 
 			// Push to ALL walFiles
 			// we don't set a common name, as filtering could generate different wals to each walfile
-			if err := r.push(ctx, wf, fullWal, byteWal, ""); err != nil {
+			err := r.push(ctx, wf, fullWal, byteWal, "")
+			r.syncStatus.recordPush(wf, 0, true, err)
+			if err != nil {
 				return
 			}
+			r.setCheckpointed(wf, checkpointTime)
 		}(wf)
 	}
 	wg.Wait()
@@ -894,31 +1283,36 @@ func BuildByteWal(el []EventLog) (*bytes.Buffer, error) {
 		return nil, err
 	}
 
-	// We need to encode the eventLog separately in order to generate a checksum
-	var elBuf bytes.Buffer
-	enc := gob.NewEncoder(&elBuf)
-	if err := enc.Encode(el); err != nil {
-		return nil, err
-	}
-
-	// Then write in the compressed bytes
-	zw := gzip.NewWriter(&outputBuf)
-	if _, err := zw.Write(elBuf.Bytes()); err != nil {
-		return nil, err
+	// Then write in the compressed, length-prefixed records
+	ww := NewWalWriter(&outputBuf)
+	for _, e := range el {
+		if err := ww.Write(e); err != nil {
+			return nil, err
+		}
 	}
 
-	if err := zw.Close(); err != nil {
+	if err := ww.Close(); err != nil {
 		return nil, err
 	}
 
 	return &outputBuf, nil
 }
 
+// getMatchedWal is called from the sync goroutines, and so holds the crdt read lock whilst inspecting it
 func (r *DBListRepo) getMatchedWal(el []EventLog, wf WalFile) []EventLog {
+	r.crdt.RLock()
+	defer r.crdt.RUnlock()
+
 	walFileOwnerEmail := wf.GetUUID()
 	_, isWebRemote := wf.(*WebWalFile)
 	isWalFileOwner := !isWebRemote || (r.email != "" && r.email == walFileOwnerEmail)
 
+	if isWalFileOwner {
+		if p := r.getWalFilePolicy(wf); p.isFiltered() {
+			return r.getPolicyWal(el, p)
+		}
+	}
+
 	// Only include those events which are/have been shared (this is handled via the event processed
 	// cache elsewhere)
 	filteredWal := []EventLog{}
@@ -928,14 +1322,58 @@ func (r *DBListRepo) getMatchedWal(el []EventLog, wf WalFile) []EventLog {
 			filteredWal = append(filteredWal, e)
 			continue
 		}
-		// TODO 2022-10-07: I've temporarily disabled per line collab until I can figure how to cleanly share all required PositionEvents as well as UpdateEvents
-		//if e.emailHasAccess(walFileOwnerEmail) {
-		//filteredWal = append(filteredWal, e)
-		//}
+		if e, isShared := r.getSharedEvent(e, walFileOwnerEmail); isShared {
+			filteredWal = append(filteredWal, e)
+		}
 	}
 	return filteredWal
 }
 
+// itemIsSharedWith checks the most recent UpdateEvent for the item, as that's where the friends state lives
+func (r *DBListRepo) itemIsSharedWith(key string, email string) bool {
+	e, exists := r.crdt.addEventSet[key]
+	return exists && e.emailHasAccess(email)
+}
+
+// getSharedEvent returns the event in the form required by a collaborator, and whether or not it should be
+// shared with them at all. UpdateEvents (which also cover visibility changes) carry their own friends state.
+// DeleteEvents and PositionEvents are shared if the item they operate on is shared. AckEvents are always shared, as
+// collaborators require them for tombstone garbage collection (see `tombstone.go`).
+func (r *DBListRepo) getSharedEvent(e EventLog, email string) (EventLog, bool) {
+	switch e.EventType {
+	case AckEvent:
+		return e, true
+	case UpdateEvent:
+		return e, e.emailHasAccess(email)
+	case DeleteEvent:
+		return e, r.itemIsSharedWith(e.ListItemKey, email)
+	case PositionEvent:
+		if !r.itemIsSharedWith(e.ListItemKey, email) {
+			return e, false
+		}
+		e.TargetListItemKey = r.getNearestTargetKey(e.TargetListItemKey, func(key string) bool {
+			return r.itemIsSharedWith(key, email)
+		})
+		return e, true
+	}
+	return e, false
+}
+
+// getNearestTargetKey returns the key of the nearest ancestor of the target (inclusive) in the crdt tree which
+// satisfies the predicate, falling back to the root. Collaborators (and filtered WalFiles) only receive a subset of
+// the tree, so targets pointing at items they can't see would otherwise leave the item orphaned (and therefore
+// hidden) on their side.
+func (r *DBListRepo) getNearestTargetKey(key string, include func(string) bool) string {
+	n := r.crdt.cache[key]
+	for n != nil && n.key != crdtRootKey && n.key != crdtOrphanKey {
+		if include(n.key) {
+			return n.key
+		}
+		n = n.parent
+	}
+	return crdtRootKey
+}
+
 func (r *DBListRepo) push(ctx context.Context, wf WalFile, el []EventLog, byteWal *bytes.Buffer, name string) error {
 	if byteWal == nil {
 		// Apply any filtering based on Push match configuration
@@ -963,9 +1401,9 @@ func (r *DBListRepo) push(ctx context.Context, wf WalFile, el []EventLog, byteWa
 	// and pull our own pushed wal)
 	// There is a chance that Flush would fail, but given the names are randomly generated, the impact of caching
 	// the broken name is small.
-	r.setProcessedWalChecksum(name)
+	r.setPushedWal(name)
 	if err := wf.Flush(ctx, byteWal, name); err != nil {
-		return err
+		return newRemoteError(wf, RemoteOpFlush, err)
 	}
 
 	return nil
@@ -973,6 +1411,7 @@ func (r *DBListRepo) push(ctx context.Context, wf WalFile, el []EventLog, byteWa
 
 func (r *DBListRepo) flushPartialWals(ctx context.Context, wal []EventLog, waitForCompletion bool) {
 	if len(wal) > 0 {
+		r.recordDeltaEvents(len(wal))
 		fullByteWal, err := BuildByteWal(wal)
 		if err != nil {
 			return
@@ -981,19 +1420,35 @@ func (r *DBListRepo) flushPartialWals(ctx context.Context, wal []EventLog, waitF
 		r.allWalFileMut.RLock()
 		defer r.allWalFileMut.RUnlock()
 		for _, wf := range r.allWalFiles {
-			if waitForCompletion {
-				wg.Add(1)
+			// Already flushed on publish
+			if wf == r.LocalWalFile && r.isWatchingLocal {
+				continue
 			}
 			var byteWal *bytes.Buffer
 			if _, isOwned := r.syncWalFiles[wf.GetUUID()]; isOwned {
-				byteWal = fullByteWal
+				p := r.getWalFilePolicy(wf)
+				if !p.canPush() {
+					continue
+				}
+				if !p.isFiltered() {
+					byteWal = fullByteWal
+				}
+			}
+			if waitForCompletion {
+				wg.Add(1)
 			}
 			go func(wf WalFile) {
 				if waitForCompletion {
 					defer wg.Done()
 				}
+				// Remotes which are backing off will receive the events on their next checkpoint
+				if !r.syncStatus.shouldAttempt(wf) {
+					r.syncStatus.recordSkippedPush(wf, len(wal))
+					return
+				}
 				// we don't set a common name, as filtering could generate different wals to each walfile
-				r.push(ctx, wf, wal, byteWal, "")
+				err := r.push(ctx, wf, wal, byteWal, "")
+				r.syncStatus.recordPush(wf, len(wal), false, err)
 			}(wf)
 		}
 		if waitForCompletion {
@@ -1002,6 +1457,67 @@ func (r *DBListRepo) flushPartialWals(ctx context.Context, wal []EventLog, waitF
 	}
 }
 
+// forwardedWal holds the events pulled from a remote which were new to us, to be pushed on to the other WalFiles
+type forwardedWal struct {
+	wal    []EventLog
+	source WalFile // the WalFile the events were pulled from, if any
+	isWeb  bool    // the events were received via the web remote, in which case all web WalFiles already hold them
+}
+
+// flushForwardedWals pushes events pulled from remotes to the WalFiles which haven't seen them. Events aren't pushed
+// back to the WalFile they came from, or to the websocket. The LocalWalFile receives them on the next checkpoint
+// (see `gather`), as other local processes pull the remotes themselves.
+func (r *DBListRepo) flushForwardedWals(ctx context.Context, forwarded []forwardedWal, waitForCompletion bool) {
+	if len(forwarded) == 0 {
+		return
+	}
+	n := 0
+	for _, f := range forwarded {
+		n += len(f.wal)
+	}
+	r.recordDeltaEvents(n)
+
+	var wg sync.WaitGroup
+	r.allWalFileMut.RLock()
+	defer r.allWalFileMut.RUnlock()
+	for _, wf := range r.allWalFiles {
+		if wf == r.LocalWalFile {
+			continue
+		}
+		if _, isOwned := r.syncWalFiles[wf.GetUUID()]; isOwned && !r.getWalFilePolicy(wf).canPush() {
+			continue
+		}
+		_, isWeb := wf.(*WebWalFile)
+		wal := []EventLog{}
+		for _, f := range forwarded {
+			if f.source == wf || (f.isWeb && isWeb) {
+				continue
+			}
+			wal = append(wal, f.wal...)
+		}
+		if len(wal) == 0 {
+			continue
+		}
+		if waitForCompletion {
+			wg.Add(1)
+		}
+		go func(wf WalFile, wal []EventLog) {
+			if waitForCompletion {
+				defer wg.Done()
+			}
+			if !r.syncStatus.shouldAttempt(wf) {
+				r.syncStatus.recordSkippedPush(wf, len(wal))
+				return
+			}
+			err := r.push(ctx, wf, wal, nil, "")
+			r.syncStatus.recordPush(wf, len(wal), false, err)
+		}(wf, wal)
+	}
+	if waitForCompletion {
+		wg.Wait()
+	}
+}
+
 func (r *DBListRepo) updateActiveFriendsMap(activeFriends, pendingFriends []string, updateChan chan interface{}) {
 	activeFriendsMap := make(map[string]struct{})
 	pendingFriendsMap := make(map[string]struct{})
@@ -1021,7 +1537,7 @@ func (r *DBListRepo) updateActiveFriendsMap(activeFriends, pendingFriends []stri
 }
 
 func (r *DBListRepo) emitRemoteUpdate(updateChan chan interface{}) {
-	if r.web.isActive {
+	if r.web.active() {
 		// We need to wrap the friendsMostRecentChangeDT comparison check, as the friend map update
 		// and subsequent friendsMostRecentChangeDT update needs to be an atomic operation
 		r.friendsUpdateLock.RLock()
@@ -1045,9 +1561,10 @@ func (r *DBListRepo) emitRemoteUpdate(updateChan chan interface{}) {
 }
 
 func (r *DBListRepo) startSync(ctx context.Context, replayChan chan namedWal, inputEvtsChan chan interface{}) error {
-	// syncTriggerChan is buffered, as the producer is called in the same thread as the consumer (to ensure a minimum of the
-	// specified wait duration)
-	syncTriggerChan := make(chan struct{}, 1)
+	// syncTriggerChan is buffered, as the producer is called in the same thread as the consumer. Triggers hold the
+	// WalFiles to pull from, where none is all owned WalFiles.
+	syncTriggerChan := make(chan []WalFile, 1)
+	pullTicker := time.NewTicker(pullInterval)
 
 	gatherTriggerTimer := time.NewTimer(gatherInterval)
 	// Drain the initial push timer, we want to wait for initial user input
@@ -1062,21 +1579,53 @@ func (r *DBListRepo) startSync(ctx context.Context, replayChan chan namedWal, in
 
 	websocketPushEvents := make(chan websocketMessage)
 
-	scheduleSync := func() {
-		select {
-		case syncTriggerChan <- struct{}{}:
-		default:
+	// scheduleSync triggers a pull from the given WalFiles, or all owned WalFiles if none are given. A pending trigger
+	// for a subset of the WalFiles is replaced by one for all of them, so periodic pulls are never dropped.
+	scheduleSync := func(walFiles ...WalFile) {
+		for {
+			select {
+			case syncTriggerChan <- walFiles:
+				return
+			default:
+			}
+			if len(walFiles) > 0 {
+				return
+			}
+			select {
+			case <-syncTriggerChan:
+			default:
+			}
 		}
 	}
 	schedulePush := func() {
 		r.pushTriggerTimer.Reset(pushInterval)
 		gatherTriggerTimer.Reset(gatherInterval)
 	}
+	// Errors are surfaced to the client rather than terminating the session. Remotes back off independently (see
+	// `shouldAttempt`), so a single failing remote doesn't affect the others.
+	notifyErr := func(err error) {
+		go func() {
+			inputEvtsChan <- SyncErrorEvent{Err: err}
+		}()
+	}
+	r.syncStatus.setErrorHandler(notifyErr)
+
+	if wf, ok := r.LocalWalFile.(*LocalFileWalFile); ok {
+		wf.removeStaleTempFiles(time.Now())
+	}
 
 	// Run an initial load from the local walfile
 	if err := r.pull(ctx, []WalFile{r.LocalWalFile}, replayChan); err != nil {
 		return err
 	}
+	// Attempt to lead other processes running against the same root directory, see `rootLock`. Followers retry on
+	// each gather, taking over once the leader exits.
+	r.isLocalLeader()
+
+	// Fall back to the periodic pull if the root directory can't be watched
+	r.watchLocalWalFile(ctx, func() {
+		scheduleSync(r.LocalWalFile)
+	})
 
 	// Main sync event loop
 	go func() {
@@ -1087,26 +1636,38 @@ func (r *DBListRepo) startSync(ctx context.Context, replayChan chan namedWal, in
 			default:
 				var err error
 				select {
-				case <-syncTriggerChan:
-					syncWalFiles := []WalFile{}
-					func() {
-						r.syncWalFileMut.RLock()
-						defer r.syncWalFileMut.RUnlock()
-						for _, wf := range r.syncWalFiles {
-							syncWalFiles = append(syncWalFiles, wf)
+				case syncWalFiles := <-syncTriggerChan:
+					isFull := len(syncWalFiles) == 0
+					if isFull {
+						func() {
+							r.syncWalFileMut.RLock()
+							defer r.syncWalFileMut.RUnlock()
+							for _, wf := range r.syncWalFiles {
+								if r.getWalFilePolicy(wf).canPull() {
+									syncWalFiles = append(syncWalFiles, wf)
+								}
+							}
+						}()
+					}
+					pullStart := time.Now()
+					var complete bool
+					if complete, err = r.pullAll(ctx, syncWalFiles, replayChan); err != nil {
+						notifyErr(err)
+					}
+					if isFull {
+						r.hasSyncedRemotes = true
+						// Periodically acknowledge complete pulls, to allow for tombstone garbage collection
+						if complete && time.Since(r.lastAck) >= ackInterval && r.hasRemotes() {
+							r.emitAck(pullStart, replayChan)
 						}
-					}()
-					if err = r.pull(ctx, syncWalFiles, replayChan); err != nil {
-						log.Fatal(err)
 					}
-					r.hasSyncedRemotes = true
+				case <-pullTicker.C:
+					scheduleSync()
 				case <-gatherTriggerTimer.C:
 					if err = r.gather(ctx); err != nil {
-						log.Fatal(err)
+						notifyErr(err)
 					}
 				}
-				time.Sleep(pullInterval)
-				scheduleSync()
 			}
 		}
 	}()
@@ -1115,6 +1676,7 @@ func (r *DBListRepo) startSync(ctx context.Context, replayChan chan namedWal, in
 	// Create a loop responsible for periodic refreshing of web connections and web walfiles.
 	// TODO only start this goroutine if there is actually a configured web
 	go func() {
+		defer close(r.webLoopDone)
 		expBackoffInterval := time.Second * 1
 		var waitInterval time.Duration
 		var webCtx context.Context
@@ -1123,16 +1685,17 @@ func (r *DBListRepo) startSync(ctx context.Context, replayChan chan namedWal, in
 			select {
 			case <-webPingTicker.C:
 				// is !isActive, we've already entered the exponential retry backoff below
-				if r.web.isActive {
+				if r.web.active() {
 					if pong, err := r.web.ping(); err != nil {
-						r.web.isActive = false
+						r.syncStatus.recordWebError(err)
+						r.web.setActive(false)
 						webRefreshTicker.Reset(time.Millisecond * 1)
 					} else {
 						r.updateActiveFriendsMap(pong.ActiveFriends, pong.PendingFriends, inputEvtsChan)
 					}
 				}
 			case m := <-websocketPushEvents:
-				if r.web.isActive {
+				if r.web.active() {
 					r.web.pushWebsocket(m)
 				}
 			case <-webRefreshTicker.C:
@@ -1142,17 +1705,26 @@ func (r *DBListRepo) startSync(ctx context.Context, replayChan chan namedWal, in
 				}
 				// Close off old websocket connection
 				// Nil check because initial instantiation also occurs async in this loop (previous it was sync on startup)
-				if r.web.wsConn != nil {
-					r.web.wsConn.Close(websocket.StatusNormalClosure, "")
+				if conn := r.web.conn(); conn != nil {
+					conn.Close(websocket.StatusNormalClosure, "")
+				}
+				// Send a state update here to ensure "offline" state is displayed if relevant. The main loop stops
+				// consuming once cancelled, as it waits for this loop to exit.
+				select {
+				case inputEvtsChan <- SyncEvent{}:
+				case <-ctx.Done():
+					return
 				}
-				// Send a state update here to ensure "offline" state is displayed if relevant
-				inputEvtsChan <- SyncEvent{}
 				// Start new one
 				err := r.registerWeb()
+				r.syncStatus.recordWebError(err)
 				if err != nil {
-					r.web.isActive = false
+					r.web.setActive(false)
 					switch err.(type) {
 					case authFailureError:
+						if webCancel != nil {
+							webCancel()
+						}
 						scheduleSync() // still trigger pull cycle for local only sync
 						return         // authFailureError signifies incorrect login details, disable web and run local only mode
 					default:
@@ -1162,7 +1734,7 @@ func (r *DBListRepo) startSync(ctx context.Context, replayChan chan namedWal, in
 						}
 					}
 				} else {
-					r.web.isActive = true
+					r.web.setActive(true)
 					expBackoffInterval = time.Second * 1
 					waitInterval = webRefreshInterval
 
@@ -1173,7 +1745,7 @@ func (r *DBListRepo) startSync(ctx context.Context, replayChan chan namedWal, in
 				// Trigger web walfile sync (mostly relevant on initial start)
 				scheduleSync()
 
-				if r.web.isActive {
+				if r.web.active() {
 					webCtx, webCancel = context.WithCancel(ctx)
 					wsConsAgg := []EventLog{}
 					wsConsChan := make(chan []EventLog)
@@ -1197,8 +1769,10 @@ func (r *DBListRepo) startSync(ctx context.Context, replayChan chan namedWal, in
 							case <-wsFlushTicker.C:
 								if len(wsConsAgg) > 0 {
 									replayChan <- namedWal{
-										name: "",
-										wal:  wsConsAgg,
+										name:     "",
+										wal:      wsConsAgg,
+										isCollab: true,
+										forward:  true,
 									}
 									wsConsAgg = []EventLog{}
 								}
@@ -1211,6 +1785,9 @@ func (r *DBListRepo) startSync(ctx context.Context, replayChan chan namedWal, in
 
 				webRefreshTicker.Reset(waitInterval)
 			case <-ctx.Done():
+				if webCancel != nil {
+					webCancel()
+				}
 				return
 			}
 		}
@@ -1244,12 +1821,14 @@ func (r *DBListRepo) startSync(ctx context.Context, replayChan chan namedWal, in
 
 	// Push to all WalFiles
 	var flushAgg, wsPubAgg []EventLog
+	var forwardAgg []forwardedWal
 	if !r.isTest {
 		go func() {
 			for {
 				select {
 				case e := <-r.eventsChan:
 					wsPubAgg = append(wsPubAgg, e)
+					r.syncStatus.addPendingEvents(1)
 				case <-ctx.Done():
 					return
 				}
@@ -1268,7 +1847,7 @@ func (r *DBListRepo) startSync(ctx context.Context, replayChan chan namedWal, in
 				}
 				r.hasUnflushedEvents = true
 				// Write in real time to the websocket, if present
-				if r.web.isActive {
+				if r.web.active() {
 					func() {
 						r.webWalFileMut.RLock()
 						defer r.webWalFileMut.RUnlock()
@@ -1290,21 +1869,35 @@ func (r *DBListRepo) startSync(ctx context.Context, replayChan chan namedWal, in
 					// Emit any remote updates if web active and local changes have occurred
 					r.emitRemoteUpdate(inputEvtsChan)
 				}
+				// Flush straight to the LocalWalFile, so other local instances receive the changes promptly
+				if r.isWatchingLocal {
+					err := r.push(ctx, r.LocalWalFile, wsPubAgg, nil, "")
+					r.syncStatus.recordPush(r.LocalWalFile, len(wsPubAgg), false, err)
+				}
 				// Add to an ephemeral log
 				flushAgg = append(flushAgg, wsPubAgg...)
 				wsPubAgg = []EventLog{}
 				// Trigger an aggregated push
 				schedulePush()
 				inputEvtsChan <- SyncEvent{}
+			case f := <-r.forwardChan:
+				// Forwarded events are pushed with the next aggregated push, but aren't published to the websocket or
+				// LocalWalFile (see `flushForwardedWals`)
+				forwardAgg = append(forwardAgg, f)
+				schedulePush()
 			case <-r.pushTriggerTimer.C:
 				// On ticks, Flush what we've aggregated to all walfiles, and then reset the
 				// ephemeral log. If empty, skip.
 				r.flushPartialWals(ctx, flushAgg, false)
+				r.flushForwardedWals(ctx, forwardAgg, false)
+				forwardAgg = nil
+				r.syncStatus.addPendingEvents(-len(flushAgg))
 				flushAgg = []EventLog{}
 				r.hasUnflushedEvents = false
 				inputEvtsChan <- SyncEvent{}
 			case <-ctx.Done():
 				r.flushPartialWals(context.Background(), flushAgg, true)
+				r.flushForwardedWals(context.Background(), forwardAgg, true)
 				go func() {
 					r.finalFlushChan <- struct{}{}
 				}()
@@ -1317,6 +1910,11 @@ func (r *DBListRepo) startSync(ctx context.Context, replayChan chan namedWal, in
 }
 
 func (r *DBListRepo) finish(purge bool) error {
+	if r.rootLock != nil {
+		defer r.rootLock.release()
+	}
+	// Attachments opened during the session are retrieved from the blobs again if re-opened
+	os.RemoveAll(r.getAttachmentCacheDir())
 	// When we pull wals from remotes, we merge into our in-mem logs, but will only flush to local walfile
 	// on gather. To ensure we store all logs locally, for now, we can just push the entire in-mem log to
 	// the local walfile. We can remove any other files to avoid overuse of local storage.
@@ -1341,11 +1939,16 @@ func (r *DBListRepo) finish(purge bool) error {
 		//}
 	} else {
 		// If purge is set, we delete everything in the local walfile. This is used primarily in the wasm browser app on logout
+		if _, ok := r.LocalWalFile.(*LocalFileWalFile); ok {
+			if _, err := r.backup(time.Now()); err != nil {
+				return err
+			}
+		}
 		r.LocalWalFile.Purge()
 	}
 
-	if r.web.wsConn != nil {
-		r.web.wsConn.Close(websocket.StatusNormalClosure, "")
+	if conn := r.web.conn(); conn != nil {
+		conn.Close(websocket.StatusNormalClosure, "")
 	}
 	return nil
 }
@@ -1360,14 +1963,14 @@ func BuildWalFromPlainText(ctx context.Context, wf WalFile, r io.Reader, isHidde
 	// any random UUID is fine
 	id := generateUUID()
 	prevKey := ""
-	var lamportTimestamp int64
+	lamportTimestamp := time.Now().UnixNano()
 	for scanner.Scan() {
 		line := scanner.Text()
 		if len(line) == 0 {
 			continue
 		}
 
-		key := strconv.Itoa(int(id)) + ":" + strconv.Itoa(int(lamportTimestamp))
+		key := strconv.FormatUint(uint64(id), 10) + ":" + strconv.FormatInt(lamportTimestamp, 10)
 		e := EventLog{
 			UUID:             id,
 			EventType:        UpdateEvent,
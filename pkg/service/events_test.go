@@ -1,8 +1,16 @@
 package service
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
 	"fmt"
+	"path"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func permutationsOfEvents(arr []EventLog) chan []EventLog {
@@ -959,6 +967,972 @@ func TestCRDTAllPermsDeletes(t *testing.T) {
 	})
 }
 
+func TestCRDTSharedEvents(t *testing.T) {
+	ownerEmail := "owner@a.com"
+	friendEmail := "friend@b.com"
+
+	// The owner repo runs the full event loop, whereas the friend repo is only used to replay events and inspect
+	// state, so it's not started
+	setupRepos := func() (*DBListRepo, *DBListRepo, func()) {
+		owner, clearUp := setupRepo()
+		owner.setEmail(ownerEmail)
+		owner.friends[friendEmail] = make(map[string]int64)
+
+		friend := NewDBListRepo(NewLocalFileWalFile(otherRootDir), NewFileWebTokenStore(otherRootDir))
+		friend.uuid = owner.uuid + 1
+		friend.setEmail(friendEmail)
+		friend.friends[ownerEmail] = make(map[string]int64)
+
+		return owner, friend, clearUp
+	}
+
+	// share simulates a push of the full state of one repo to the other's WebWalFile (as per `gather`)
+	share := func(from, to *DBListRepo) {
+		wal := from.getMatchedWal(from.crdt.generateEvents(), &WebWalFile{uuid: to.email})
+
+		// Round trip the events through the wal encoding, as a real remote would
+		b, err := BuildByteWal(wal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		el, err := to.buildFromFile(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		to.Replay(el)
+	}
+
+	// addItems adds `a`, `b`, `c` and `d` in that order, with `b` and `d` shared with the friend
+	addItems := func(repo *DBListRepo) []string {
+		keys := []string{}
+		var child *ListItem
+		for _, line := range []string{"a", "b @" + friendEmail, "c", "d @" + friendEmail} {
+			k, _ := repo.Add(line, nil, child)
+			child = repo.listItemCache[k]
+			keys = append(keys, k)
+		}
+		return keys
+	}
+
+	checkLines := func(t *testing.T, repo *DBListRepo, showHidden bool, expected []string) {
+		matches, _, _ := repo.Match([][]rune{}, showHidden, "", 0, 0)
+		if len(matches) != len(expected) {
+			t.Fatalf("expected %d matches but got %d", len(expected), len(matches))
+		}
+		for i, m := range matches {
+			if m.Line() != expected[i] {
+				t.Errorf("expected line %d to be %s but got %s", i, expected[i], m.Line())
+			}
+		}
+	}
+
+	t.Run("Only shared items are sent", func(t *testing.T) {
+		owner, friend, clearUp := setupRepos()
+		defer clearUp()
+
+		keys := addItems(owner)
+		checkLines(t, owner, false, []string{"a", "b", "c", "d"})
+
+		share(owner, friend)
+		checkLines(t, friend, false, []string{"b", "d"})
+
+		for _, k := range []string{keys[0], keys[2]} {
+			if _, exists := friend.crdt.addEventSet[k]; exists {
+				t.Errorf("unshared item %s should not be sent to friend", k)
+			}
+		}
+
+		friendItem := friend.listItemCache[keys[1]]
+		if friends := friendItem.Friends(); len(friends) != 1 || friends[0] != ownerEmail {
+			t.Errorf("owner should be the only collaborator visible to the friend, got %v", friends)
+		}
+	})
+	t.Run("Position targets are remapped to shared items", func(t *testing.T) {
+		owner, _, clearUp := setupRepos()
+		defer clearUp()
+
+		keys := addItems(owner)
+
+		for _, e := range owner.getMatchedWal(owner.crdt.generateEvents(), &WebWalFile{uuid: friendEmail}) {
+			if e.EventType != PositionEvent {
+				continue
+			}
+			switch e.ListItemKey {
+			case keys[1]:
+				if e.TargetListItemKey != crdtRootKey {
+					t.Errorf("first shared item should target the root")
+				}
+			case keys[3]:
+				if e.TargetListItemKey != keys[1] {
+					t.Errorf("second shared item should target the first shared item")
+				}
+			default:
+				t.Errorf("unshared position event should not be sent")
+			}
+		}
+	})
+	t.Run("Deletes and visibility changes are sent", func(t *testing.T) {
+		owner, friend, clearUp := setupRepos()
+		defer clearUp()
+
+		keys := addItems(owner)
+		share(owner, friend)
+
+		owner.Match([][]rune{}, true, "", 0, 0)
+		owner.Delete(owner.listItemCache[keys[1]])
+		owner.Match([][]rune{}, true, "", 0, 0)
+		owner.ToggleVisibility(owner.listItemCache[keys[3]])
+		// Deleting an unshared item shouldn't affect the friend
+		owner.Match([][]rune{}, true, "", 0, 0)
+		owner.Delete(owner.listItemCache[keys[2]])
+
+		share(owner, friend)
+		checkLines(t, friend, false, []string{})
+		checkLines(t, friend, true, []string{"d"})
+	})
+	t.Run("Friend changes are sent back without moving owner items", func(t *testing.T) {
+		owner, friend, clearUp := setupRepos()
+		defer clearUp()
+
+		keys := addItems(owner)
+		share(owner, friend)
+
+		// Mimic `Update` on the friend side (the friend repo event loop isn't running)
+		e := friend.update("d2", friend.listItemCache[keys[3]])
+		e.LamportTimestamp = owner.clock.next()
+		friend.processEventLog(friend.repositionActiveFriends(e))
+		checkLines(t, friend, false, []string{"b", "d2"})
+
+		share(friend, owner)
+		checkLines(t, owner, false, []string{"a", "b", "c", "d2"})
+
+		if _, exists := owner.crdt.positionEventSet[keys[2]]; !exists {
+			t.Errorf("owner item should still be positioned")
+		}
+	})
+	t.Run("Shared wals are built concurrently with replays", func(t *testing.T) {
+		// The friend repo isn't started, so only the goroutines below access its crdt (run with -race)
+		_, friend, clearUp := setupRepos()
+		defer clearUp()
+
+		el := []EventLog{}
+		for i := int64(1); i <= 200; i++ {
+			key := fmt.Sprintf("%d:%d", friend.uuid, i)
+			el = append(el,
+				EventLog{UUID: friend.uuid, LamportTimestamp: i, EventType: UpdateEvent, ListItemKey: key, Line: "a @" + ownerEmail},
+				EventLog{UUID: friend.uuid, LamportTimestamp: i, EventType: PositionEvent, ListItemKey: key},
+				EventLog{UUID: friend.uuid, LamportTimestamp: i + 1, EventType: DeleteEvent, ListItemKey: key},
+			)
+		}
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := range el {
+				friend.Replay(el[i : i+1])
+			}
+		}()
+		for i := 0; i < 50; i++ {
+			friend.getMatchedWal(el, &WebWalFile{uuid: ownerEmail})
+		}
+		<-done
+	})
+}
+
+func TestCRDTReadOnlyFriends(t *testing.T) {
+	ownerEmail := "owner@a.com"
+	friendEmail := "friend@b.com"
+	sharedKey := "1:1"
+	configKey := "1:2"
+
+	setupOwnerRepo := func() *DBListRepo {
+		repo := NewDBListRepo(NewLocalFileWalFile(otherRootDir), NewFileWebTokenStore(otherRootDir))
+		repo.uuid = uuid(1)
+		repo.setEmail(ownerEmail)
+		repo.Replay([]EventLog{
+			{
+				UUID:             1,
+				LamportTimestamp: 1,
+				EventType:        UpdateEvent,
+				ListItemKey:      sharedKey,
+				Line:             "shared",
+				AuthorEmail:      ownerEmail,
+			},
+			{
+				UUID:             1,
+				LamportTimestamp: 1,
+				EventType:        PositionEvent,
+				ListItemKey:      sharedKey,
+				AuthorEmail:      ownerEmail,
+			},
+		})
+		return repo
+	}
+
+	setConfig := func(repo *DBListRepo, ts int64, friend string) {
+		repo.Replay([]EventLog{
+			{
+				UUID:             1,
+				LamportTimestamp: ts,
+				EventType:        UpdateEvent,
+				ListItemKey:      configKey,
+				Line:             fmt.Sprintf("fzn_cfg:friend %s @%s", friend, ownerEmail),
+				AuthorEmail:      ownerEmail,
+			},
+		})
+	}
+
+	friendUpdate := func(ts int64, line string) EventLog {
+		return EventLog{
+			UUID:             2,
+			LamportTimestamp: ts,
+			EventType:        UpdateEvent,
+			ListItemKey:      sharedKey,
+			Line:             line,
+			AuthorEmail:      friendEmail,
+		}
+	}
+
+	// receive simulates events arriving via the web remote, as per the replay loop in `Start`
+	receive := func(repo *DBListRepo, el ...EventLog) {
+		repo.Replay(repo.filterCollaboratorEvents(el))
+	}
+
+	t.Run("Read-only friend events are rejected", func(t *testing.T) {
+		repo := setupOwnerRepo()
+		setConfig(repo, 2, friendEmail+readOnlyFriendSuffix)
+
+		if !repo.friendIsReadOnly(friendEmail) {
+			t.Fatalf("friend should be read-only")
+		}
+		if _, exists := repo.friends[friendEmail]; !exists {
+			t.Fatalf("read-only friend should still be added to the friends cache")
+		}
+
+		receive(repo, friendUpdate(3, "edited"))
+		if l := repo.listItemCache[sharedKey].Line(); l != "shared" {
+			t.Errorf("line should not have been edited, but is %s", l)
+		}
+	})
+	t.Run("Full access friend events are accepted", func(t *testing.T) {
+		repo := setupOwnerRepo()
+		setConfig(repo, 2, friendEmail)
+
+		if repo.friendIsReadOnly(friendEmail) {
+			t.Fatalf("friend should not be read-only")
+		}
+
+		receive(repo, friendUpdate(3, "edited"))
+		if l := repo.listItemCache[sharedKey].Line(); l != "edited" {
+			t.Errorf("line should have been edited, but is %s", l)
+		}
+	})
+	t.Run("Access mode can be changed", func(t *testing.T) {
+		repo := setupOwnerRepo()
+		setConfig(repo, 2, friendEmail+readOnlyFriendSuffix)
+		setConfig(repo, 3, friendEmail)
+
+		receive(repo, friendUpdate(4, "edited"))
+		if l := repo.listItemCache[sharedKey].Line(); l != "edited" {
+			t.Errorf("line should have been edited, but is %s", l)
+		}
+
+		setConfig(repo, 5, friendEmail+readOnlyFriendSuffix)
+		receive(repo, friendUpdate(6, "edited again"))
+		if l := repo.listItemCache[sharedKey].Line(); l != "edited" {
+			t.Errorf("line should not have been edited again, but is %s", l)
+		}
+	})
+	t.Run("Events accepted before the friend became read-only survive a replay", func(t *testing.T) {
+		repo := setupOwnerRepo()
+		setConfig(repo, 2, friendEmail)
+		receive(repo, friendUpdate(3, "edited"))
+		setConfig(repo, 4, friendEmail+readOnlyFriendSuffix)
+
+		// Simulate a restart, replaying the accepted state in both orders, as `generateEvents` is built from maps
+		el := repo.crdt.generateEvents()
+		for _, reverse := range []bool{false, true} {
+			restarted := NewDBListRepo(NewLocalFileWalFile(otherRootDir), NewFileWebTokenStore(otherRootDir))
+			restarted.uuid = uuid(1)
+			restarted.setEmail(ownerEmail)
+			for i := range el {
+				e := el[i]
+				if reverse {
+					e = el[len(el)-1-i]
+				}
+				restarted.Replay([]EventLog{e})
+			}
+			if !restarted.friendIsReadOnly(friendEmail) {
+				t.Fatalf("friend should be read-only after the replay")
+			}
+			if l := restarted.listItemCache[sharedKey].Line(); l != "edited" {
+				t.Errorf("edit made with full access should be retained, but line is %s", l)
+			}
+		}
+	})
+	t.Run("Events made before the friend became read-only are accepted", func(t *testing.T) {
+		repo := setupOwnerRepo()
+		setConfig(repo, 4, friendEmail+readOnlyFriendSuffix)
+
+		// e.g. another owner device checkpoints an edit it accepted before the access mode changed
+		receive(repo, friendUpdate(3, "edited"))
+		if l := repo.listItemCache[sharedKey].Line(); l != "edited" {
+			t.Errorf("line should have been edited, but is %s", l)
+		}
+	})
+	t.Run("Unattributed events on items shared with read-only friends are rejected", func(t *testing.T) {
+		repo := setupOwnerRepo()
+		repo.Replay([]EventLog{{
+			UUID:             1,
+			LamportTimestamp: 2,
+			EventType:        UpdateEvent,
+			ListItemKey:      sharedKey,
+			Line:             "shared",
+			Friends:          LineFriends{Emails: []string{ownerEmail, friendEmail}},
+			AuthorEmail:      ownerEmail,
+		}})
+		setConfig(repo, 3, friendEmail+readOnlyFriendSuffix)
+
+		for _, author := range []string{"", "someone@c.com"} {
+			e := friendUpdate(4, "edited")
+			e.AuthorEmail = author
+			receive(repo, e)
+		}
+		if l := repo.listItemCache[sharedKey].Line(); l != "shared" {
+			t.Errorf("line should not have been edited, but is %s", l)
+		}
+
+		// The owner's own devices are unaffected
+		e := friendUpdate(5, "owner edit")
+		e.AuthorEmail = ownerEmail
+		receive(repo, e)
+		if l := repo.listItemCache[sharedKey].Line(); l != "owner edit" {
+			t.Errorf("line should have been edited by the owner, but is %s", l)
+		}
+	})
+}
+
+func TestCRDTHybridLogicalClock(t *testing.T) {
+	t.Run("Timestamps encode wall clock time", func(t *testing.T) {
+		repo := NewDBListRepo(NewLocalFileWalFile(otherRootDir), NewFileWebTokenStore(otherRootDir))
+
+		before := wallTime(hlcPhysical(time.Now().UnixNano()))
+		e := repo.newEventLog(UpdateEvent)
+		if wt := wallTime(e.LamportTimestamp); wt.Before(before) || wt.After(time.Now()) {
+			t.Errorf("Unexpected wall time %v", wt)
+		}
+	})
+	t.Run("Logical counter orders events within a physical tick", func(t *testing.T) {
+		now := time.Now()
+		c := newHLC()
+		c.now = func() time.Time { return now }
+
+		a, b := c.next(), c.next()
+		if hlcPhysical(a) != hlcPhysical(b) || b != a+1 {
+			t.Errorf("Expected %d to directly follow %d within the same physical tick", b, a)
+		}
+
+		// The counter resets once the wall clock moves on
+		now = now.Add(time.Millisecond)
+		if next := c.next(); next&hlcLogicalMask != 0 || next <= b {
+			t.Errorf("Expected the logical counter to reset, got %d after %d", next, b)
+		}
+	})
+	t.Run("Observed timestamps within the drift bound move the clock", func(t *testing.T) {
+		now := time.Now()
+		c := newHLC()
+		c.now = func() time.Time { return now }
+
+		ahead := hlcPhysical(now.Add(time.Minute).UnixNano()) + 3
+		c.observe(ahead)
+		if next := c.next(); next != ahead+1 {
+			t.Errorf("Expected %d but got %d", ahead+1, next)
+		}
+	})
+	t.Run("Observed timestamps beyond the drift bound are capped", func(t *testing.T) {
+		now := time.Now()
+		c := newHLC()
+		c.now = func() time.Time { return now }
+
+		c.observe(now.Add(24 * time.Hour).UnixNano())
+		if next := c.next(); wallTime(next).After(now.Add(maxClockDrift)) {
+			t.Errorf("Clock should not move beyond the drift bound, but is at %v", wallTime(next))
+		}
+	})
+	t.Run("Local changes order after items with timestamps beyond the drift bound", func(t *testing.T) {
+		repo := NewDBListRepo(NewLocalFileWalFile(otherRootDir), NewFileWebTokenStore(otherRootDir))
+
+		// Simulate an event from a device with a fast clock
+		future := time.Now().Add(time.Hour).UnixNano()
+		repo.Replay([]EventLog{{
+			UUID:             repo.uuid + 1,
+			LamportTimestamp: future,
+			EventType:        UpdateEvent,
+			ListItemKey:      "1:1",
+			Line:             "remote",
+		}})
+
+		// Mimic `Update` (the repo event loop isn't running)
+		repo.processEventLog(repo.update("local", repo.listItemCache["1:1"]))
+		if l := repo.listItemCache["1:1"].Line(); l != "local" {
+			t.Errorf("Local change should override the remote event, but line is %s", l)
+		}
+		if next := repo.clock.next(); wallTime(next).After(time.Now().Add(maxClockDrift)) {
+			t.Errorf("Clock should not move beyond the drift bound, but is at %v", wallTime(next))
+		}
+	})
+	t.Run("Lamport timestamps have no wall time", func(t *testing.T) {
+		if wt := wallTime(42); !wt.IsZero() {
+			t.Errorf("Expected zero time but got %v", wt)
+		}
+	})
+	t.Run("Schema 7 wals are migrated", func(t *testing.T) {
+		repo := NewDBListRepo(NewLocalFileWalFile(otherRootDir), NewFileWebTokenStore(otherRootDir))
+
+		legacyEl := []EventLogSchema7{
+			{
+				UUID:             1,
+				LamportTimestamp: 1,
+				EventType:        UpdateEvent,
+				ListItemKey:      "1:1",
+				Line:             "legacy",
+			},
+			{
+				UUID:             1,
+				LamportTimestamp: 2,
+				EventType:        PositionEvent,
+				ListItemKey:      "1:1",
+			},
+		}
+
+		var b bytes.Buffer
+		binary.Write(&b, binary.LittleEndian, uint16(7))
+		zw := gzip.NewWriter(&b)
+		if err := gob.NewEncoder(zw).Encode(legacyEl); err != nil {
+			t.Fatal(err)
+		}
+		zw.Close()
+
+		el, err := repo.buildFromFile(&b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(el) != len(legacyEl) {
+			t.Fatalf("Expected %d events but got %d", len(legacyEl), len(el))
+		}
+		for i, e := range el {
+			if e.LamportTimestamp != legacyEl[i].LamportTimestamp || e.UUID != legacyEl[i].UUID {
+				t.Errorf("Event %d should retain the legacy timestamp and UUID", i)
+			}
+		}
+
+		repo.Replay(el)
+		e := repo.newEventLog(UpdateEvent)
+		e.ListItemKey = "1:1"
+		e.Line = "updated"
+		repo.Replay([]EventLog{e})
+
+		matches, _, _ := repo.Match([][]rune{}, true, "", 0, 0)
+		if len(matches) != 1 || matches[0].Line() != "updated" {
+			t.Fatalf("HLC events should order after migrated events")
+		}
+	})
+}
+
+func TestWalEncoding(t *testing.T) {
+	el := []EventLog{
+		{
+			UUID:             1,
+			LamportTimestamp: time.Now().UnixNano(),
+			EventType:        UpdateEvent,
+			ListItemKey:      "1:1",
+			Line:             "line @joe@bloggs.com",
+			Note:             []byte("note"),
+			IsHidden:         true,
+			Friends: LineFriends{
+				IsProcessed: true,
+				Offset:      4,
+				Emails:      []string{"joe@bloggs.com"},
+			},
+			Attachments: []Attachment{
+				{
+					Name:     "file.txt",
+					Checksum: "abc",
+					Size:     3,
+				},
+			},
+			AuthorEmail: "jane@bloggs.com",
+			DeviceID:    42,
+		},
+		{
+			UUID:              1,
+			LamportTimestamp:  time.Now().UnixNano(),
+			EventType:         PositionEvent,
+			ListItemKey:       "1:1",
+			TargetListItemKey: "1:0",
+		},
+		{
+			UUID:             2,
+			LamportTimestamp: 3,
+			EventType:        DeleteEvent,
+			ListItemKey:      "2:3",
+		},
+	}
+
+	checkEvents := func(t *testing.T, expected, actual []EventLog) {
+		if len(actual) != len(expected) {
+			t.Fatalf("Expected %d events but got %d", len(expected), len(actual))
+		}
+		for i := range expected {
+			if !reflect.DeepEqual(expected[i], actual[i]) {
+				t.Errorf("Event %d mismatch, expected %+v but got %+v", i, expected[i], actual[i])
+			}
+		}
+	}
+
+	t.Run("Round trip", func(t *testing.T) {
+		repo := NewDBListRepo(NewLocalFileWalFile(otherRootDir), NewFileWebTokenStore(otherRootDir))
+
+		b, err := BuildByteWal(el)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := repo.buildFromFile(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkEvents(t, el, decoded)
+	})
+	t.Run("Append to existing wal", func(t *testing.T) {
+		repo := NewDBListRepo(NewLocalFileWalFile(otherRootDir), NewFileWebTokenStore(otherRootDir))
+
+		b, err := BuildByteWal(el[:1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		ww := NewWalWriter(b)
+		for _, e := range el[1:] {
+			if err := ww.Write(e); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := ww.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		decoded, err := repo.buildFromFile(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkEvents(t, el, decoded)
+	})
+	t.Run("Truncated wal is partially readable", func(t *testing.T) {
+		b, err := BuildByteWal(el[:2])
+		if err != nil {
+			t.Fatal(err)
+		}
+		var appended bytes.Buffer
+		ww := NewWalWriter(&appended)
+		ww.Write(el[2])
+		ww.Close()
+		b.Write(appended.Bytes()[:appended.Len()/2])
+
+		// Skip the schema ID
+		b.Next(2)
+		decoded, err := decodeWal(b)
+		if err == nil {
+			t.Errorf("Expected an error for the truncated wal")
+		}
+		checkEvents(t, el[:2], decoded)
+	})
+	t.Run("Convert legacy wal", func(t *testing.T) {
+		repo := NewDBListRepo(NewLocalFileWalFile(otherRootDir), NewFileWebTokenStore(otherRootDir))
+
+		// Build a schema v7 (gob) wal, which predates attachments and authors
+		legacyEl, expected := []EventLogSchema7{}, []EventLog{}
+		for _, e := range el {
+			e.Attachments, e.AuthorEmail, e.DeviceID = nil, "", 0
+			expected = append(expected, e)
+			legacyEl = append(legacyEl, EventLogSchema7{
+				UUID:              e.UUID,
+				LamportTimestamp:  e.LamportTimestamp,
+				EventType:         e.EventType,
+				ListItemKey:       e.ListItemKey,
+				TargetListItemKey: e.TargetListItemKey,
+				Line:              e.Line,
+				Note:              e.Note,
+				IsHidden:          e.IsHidden,
+				Friends:           e.Friends,
+			})
+		}
+		var legacy bytes.Buffer
+		binary.Write(&legacy, binary.LittleEndian, uint16(7))
+		zw := gzip.NewWriter(&legacy)
+		if err := gob.NewEncoder(zw).Encode(legacyEl); err != nil {
+			t.Fatal(err)
+		}
+		zw.Close()
+
+		var converted bytes.Buffer
+		if err := repo.ConvertWal(&legacy, &converted); err != nil {
+			t.Fatal(err)
+		}
+
+		var schemaID uint16
+		binary.Read(bytes.NewReader(converted.Bytes()), binary.LittleEndian, &schemaID)
+		if schemaID != LatestWalSchemaID {
+			t.Errorf("Expected schema ID %d but got %d", LatestWalSchemaID, schemaID)
+		}
+
+		decoded, err := repo.buildFromFile(&converted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkEvents(t, expected, decoded)
+	})
+}
+
+func TestCompaction(t *testing.T) {
+	ctx := context.Background()
+
+	setup := func(cfg CompactionConfig) (*DBListRepo, WalFile, func() int) {
+		repo := NewDBListRepo(NewLocalFileWalFile(otherRootDir), NewFileWebTokenStore(otherRootDir))
+		repo.SetCompactionConfig(cfg)
+		remote := &remoteWalFile{NewLocalFileWalFile(t.TempDir())}
+		repo.AddWalFile(remote, true)
+		countWals := func() int {
+			wals, _ := remote.GetMatchingWals(ctx, path.Join(remote.GetRoot(), "wal_*.db"))
+			return len(wals)
+		}
+		return repo, remote, countWals
+	}
+
+	addEvent := func(repo *DBListRepo, i int) []EventLog {
+		e := repo.newEventLog(UpdateEvent)
+		e.ListItemKey = fmt.Sprintf("%d:%d", repo.uuid, i)
+		e.Line = fmt.Sprintf("line %d", i)
+		repo.Replay([]EventLog{e})
+		return []EventLog{e}
+	}
+
+	t.Run("Checkpoint on wal count", func(t *testing.T) {
+		repo, remote, countWals := setup(CompactionConfig{MaxDeltaWals: 2})
+
+		addEvent(repo, 0)
+		if err := repo.gather(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if n := countWals(); n != 1 {
+			t.Fatalf("Expected an initial checkpoint, but got %d wals", n)
+		}
+
+		for i := 1; i <= 2; i++ {
+			repo.flushPartialWals(ctx, addEvent(repo, i), true)
+			repo.gather(ctx)
+		}
+		if n := countWals(); n != 3 {
+			t.Fatalf("Expected a checkpoint and 2 deltas, but got %d wals", n)
+		}
+
+		repo.flushPartialWals(ctx, addEvent(repo, 3), true)
+		repo.gather(ctx)
+		if n := countWals(); n != 1 {
+			t.Fatalf("Expected the deltas to be compacted, but got %d wals", n)
+		}
+
+		// The checkpoint should hold the full state
+		wals, _ := remote.GetMatchingWals(ctx, path.Join(remote.GetRoot(), "wal_*.db"))
+		var raw bytes.Buffer
+		if err := remote.GetWalBytes(ctx, &raw, wals[0]); err != nil {
+			t.Fatal(err)
+		}
+		otherRepo := NewDBListRepo(NewLocalFileWalFile(otherRootDir), NewFileWebTokenStore(otherRootDir))
+		el, err := otherRepo.buildFromFile(&raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(el) != 4 {
+			t.Errorf("Expected 4 events in the checkpoint, but got %d", len(el))
+		}
+	})
+	t.Run("Checkpoint on event count", func(t *testing.T) {
+		repo, _, countWals := setup(CompactionConfig{MaxDeltaEvents: 3})
+
+		addEvent(repo, 0)
+		repo.gather(ctx)
+
+		for i := 1; i <= 2; i++ {
+			repo.flushPartialWals(ctx, addEvent(repo, i), true)
+			repo.gather(ctx)
+		}
+		if n := countWals(); n != 3 {
+			t.Fatalf("Expected a checkpoint and 2 deltas, but got %d wals", n)
+		}
+
+		// Pulled events count towards the threshold
+		repo.recordDeltaEvents(1)
+		repo.gather(ctx)
+		if n := countWals(); n != 1 {
+			t.Fatalf("Expected the deltas to be compacted, but got %d wals", n)
+		}
+	})
+	t.Run("Zero config checkpoints on every gather", func(t *testing.T) {
+		repo, _, countWals := setup(CompactionConfig{})
+
+		for i := 0; i < 3; i++ {
+			repo.flushPartialWals(ctx, addEvent(repo, i), true)
+			repo.gather(ctx)
+			if n := countWals(); n != 1 {
+				t.Fatalf("Expected a single checkpoint, but got %d wals", n)
+			}
+		}
+	})
+	t.Run("Events pulled from remotes are forwarded once", func(t *testing.T) {
+		repo, remote, countWals := setup(CompactionConfig{})
+		other := &namedWalFile{remoteWalFile: &remoteWalFile{NewLocalFileWalFile(t.TempDir())}, uuid: "other"}
+		repo.AddWalFile(other, true)
+
+		// Another device pushes a wal to the remote
+		otherRepo := NewDBListRepo(NewLocalFileWalFile(otherRootDir), NewFileWebTokenStore(otherRootDir))
+		el := addEvent(otherRepo, 0)
+		b, err := BuildByteWal(el)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := remote.Flush(ctx, b, "other"); err != nil {
+			t.Fatal(err)
+		}
+
+		replayChan := make(chan namedWal)
+		pulled := make(chan namedWal, 1)
+		go func() {
+			for n := range replayChan {
+				pulled <- n
+			}
+		}()
+		if err := repo.pull(ctx, []WalFile{remote}, replayChan); err != nil {
+			t.Fatal(err)
+		}
+		n := <-pulled
+		if !n.forward || n.source != remote {
+			t.Fatalf("Wals pulled from remotes should be forwarded")
+		}
+
+		unseen := repo.getUnseenEvents(n.wal)
+		if len(unseen) != len(el) {
+			t.Fatalf("Expected %d unseen events, but got %d", len(el), len(unseen))
+		}
+		repo.Replay(n.wal)
+
+		// The events are only pushed to the WalFiles which haven't seen them
+		repo.flushForwardedWals(ctx, []forwardedWal{{wal: unseen, source: n.source}}, true)
+		if n := countWals(); n != 1 {
+			t.Errorf("Events shouldn't be forwarded back to their source, but got %d wals", n)
+		}
+		if wals, _ := other.GetMatchingWals(ctx, path.Join(other.GetRoot(), "wal_*.db")); len(wals) != 1 {
+			t.Errorf("Expected the events to be forwarded to the other remote, but got %d wals", len(wals))
+		}
+		if wals, _ := repo.LocalWalFile.GetMatchingWals(ctx, path.Join(repo.LocalWalFile.GetRoot(), "wal_*.db")); len(wals) != 0 {
+			t.Errorf("Forwarded events should only reach the LocalWalFile on checkpoint, but got %d wals", len(wals))
+		}
+		// Once processed, echoes of the events (e.g. forwarded back by other devices) aren't forwarded again
+		if unseen := repo.getUnseenEvents(n.wal); len(unseen) != 0 {
+			t.Errorf("Expected no unseen events after replay, but got %d", len(unseen))
+		}
+	})
+}
+
+func TestCRDTTombstoneGC(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-time.Hour * 48).UnixNano()
+
+	setup := func() *DBListRepo {
+		repo := NewDBListRepo(NewLocalFileWalFile(otherRootDir), NewFileWebTokenStore(otherRootDir))
+		repo.SetTombstoneHorizon(time.Hour * 24)
+		// "1:1" <- "1:2" (positioned below "1:1"), and "1:3", all of which are deleted
+		for i, target := range []string{"", "1:1", ""} {
+			key := fmt.Sprintf("1:%d", i+1)
+			ts := old + int64(i*10)
+			repo.Replay([]EventLog{
+				{UUID: 1, DeviceID: 1, LamportTimestamp: ts, EventType: UpdateEvent, ListItemKey: key, Line: key},
+				{UUID: 1, DeviceID: 1, LamportTimestamp: ts + 1, EventType: PositionEvent, ListItemKey: key, TargetListItemKey: target},
+				{UUID: 1, DeviceID: 1, LamportTimestamp: ts + 2, EventType: DeleteEvent, ListItemKey: key},
+			})
+		}
+		return repo
+	}
+	ack := func(repo *DBListRepo, id uuid, ts int64) {
+		repo.Replay([]EventLog{{UUID: id, DeviceID: id, LamportTimestamp: ts, EventType: AckEvent}})
+	}
+
+	t.Run("Requires acks", func(t *testing.T) {
+		repo := setup()
+		if pruned := repo.collectGarbage(now); len(pruned) != 0 {
+			t.Errorf("Nothing should be pruned without acks, but got %v", pruned)
+		}
+	})
+	t.Run("Requires acks from all known devices", func(t *testing.T) {
+		repo := setup()
+		ack(repo, 1, now.UnixNano())
+		ack(repo, 2, old)
+		if pruned := repo.collectGarbage(now); len(pruned) != 0 {
+			t.Errorf("Nothing should be pruned, but got %v", pruned)
+		}
+	})
+	t.Run("Requires acks from all devices with events", func(t *testing.T) {
+		repo := setup()
+		ack(repo, 1, now.UnixNano())
+		// Device 2 has never acknowledged anything, and edits "1:3" concurrently with (but ordered before) the delete
+		concurrent := EventLog{UUID: 2, DeviceID: 2, LamportTimestamp: old + 21, EventType: UpdateEvent, ListItemKey: "1:3", Line: "edited"}
+		repo.Replay([]EventLog{{UUID: 2, DeviceID: 2, LamportTimestamp: old + 5, EventType: UpdateEvent, ListItemKey: "2:1", Line: "2:1"}})
+		if pruned := repo.collectGarbage(now); len(pruned) != 0 {
+			t.Fatalf("Nothing should be pruned, but got %v", pruned)
+		}
+		// The tombstone is retained, so the late event can't resurrect the item
+		repo.Replay([]EventLog{concurrent})
+		if repo.crdt.itemIsLive("1:3") {
+			t.Errorf("1:3 should not be resurrected")
+		}
+	})
+	t.Run("Acks are kept per device", func(t *testing.T) {
+		repo := setup()
+		// Each process on device 1 acknowledges under its own origin
+		for i := 0; i < 5; i++ {
+			repo.Replay([]EventLog{{UUID: uuid(10 + i), DeviceID: 1, LamportTimestamp: old + int64(i), EventType: AckEvent}})
+		}
+		if l := len(repo.crdt.ackEventSet); l != 1 {
+			t.Fatalf("Expected a single ack, but got %d", l)
+		}
+		if pruned := repo.collectGarbage(now); len(pruned) != 0 {
+			t.Fatalf("Nothing should be pruned, but got %v", pruned)
+		}
+		repo.Replay([]EventLog{{UUID: 20, DeviceID: 1, LamportTimestamp: now.UnixNano(), EventType: AckEvent}})
+		if pruned := repo.collectGarbage(now); len(pruned) != 3 {
+			t.Errorf("Expected 3 pruned items, but got %v", pruned)
+		}
+	})
+	t.Run("The current device is acknowledged", func(t *testing.T) {
+		repo := setup()
+		repo.device.ID = 1
+		if pruned := repo.collectGarbage(now); len(pruned) != 3 {
+			t.Errorf("Expected 3 pruned items, but got %v", pruned)
+		}
+	})
+	t.Run("Prunes legacy tombstones after the migration horizon", func(t *testing.T) {
+		repo := setup()
+		repo.Replay([]EventLog{
+			{UUID: 4, LamportTimestamp: 1, EventType: UpdateEvent, ListItemKey: "4:1", Line: "4:1"},
+			{UUID: 4, LamportTimestamp: 2, EventType: DeleteEvent, ListItemKey: "4:1"},
+		})
+		ack(repo, 1, now.UnixNano())
+		pruned := repo.collectGarbage(now)
+		if len(pruned) != 4 {
+			t.Fatalf("Expected 4 pruned items, but got %v", pruned)
+		}
+		if _, exists := repo.crdt.deleteEventSet["4:1"]; exists {
+			t.Errorf("Legacy tombstones should be pruned")
+		}
+	})
+	t.Run("Retains legacy tombstones within the migration horizon", func(t *testing.T) {
+		repo := NewDBListRepo(NewLocalFileWalFile(otherRootDir), NewFileWebTokenStore(otherRootDir))
+		repo.SetTombstoneHorizon(time.Hour * 24)
+		repo.Replay([]EventLog{
+			{UUID: 4, LamportTimestamp: 1, EventType: UpdateEvent, ListItemKey: "4:1", Line: "4:1"},
+			{UUID: 4, LamportTimestamp: 2, EventType: DeleteEvent, ListItemKey: "4:1"},
+		})
+		if pruned := repo.collectGarbage(now); len(pruned) != 0 {
+			t.Fatalf("Legacy tombstones should be retained before migration, but got %v", pruned)
+		}
+		// Migrated an hour ago
+		ack(repo, 1, now.Add(-time.Hour).UnixNano())
+		if pruned := repo.collectGarbage(now); len(pruned) != 0 {
+			t.Errorf("Legacy tombstones should be retained within the horizon, but got %v", pruned)
+		}
+	})
+	t.Run("Requires compacted WalFiles", func(t *testing.T) {
+		repo := setup()
+		ack(repo, 1, now.UnixNano())
+		repo.AddWalFileWithPolicy(&remoteWalFile{NewLocalFileWalFile(otherRootDir)}, WalFilePolicy{Direction: SyncPullOnly})
+		if pruned := repo.collectGarbage(now); len(pruned) != 0 {
+			t.Errorf("Nothing should be pruned whilst pulling from an uncompacted WalFile, but got %v", pruned)
+		}
+	})
+	t.Run("Requires the horizon", func(t *testing.T) {
+		repo := setup()
+		repo.SetTombstoneHorizon(time.Hour * 72)
+		ack(repo, 1, now.UnixNano())
+		if pruned := repo.collectGarbage(now); len(pruned) != 0 {
+			t.Errorf("Nothing should be pruned, but got %v", pruned)
+		}
+	})
+	t.Run("Prunes acknowledged deletes", func(t *testing.T) {
+		repo := setup()
+		ack(repo, 1, now.UnixNano())
+		ack(repo, 2, now.UnixNano())
+
+		if pruned := repo.collectGarbage(now); len(pruned) != 3 {
+			t.Fatalf("Expected 3 pruned items, but got %v", pruned)
+		}
+		for _, e := range repo.crdt.generateEvents() {
+			if e.EventType != AckEvent {
+				t.Errorf("Expected only acks to remain, but got %v", e)
+			}
+		}
+		if len(repo.listItemCache) != 0 {
+			t.Errorf("Expected empty listItemCache, but got %d items", len(repo.listItemCache))
+		}
+	})
+	t.Run("Retains items with live children", func(t *testing.T) {
+		repo := setup()
+		ack(repo, 1, now.UnixNano())
+		ack(repo, 2, now.UnixNano())
+		// Re-add "1:2"
+		repo.Replay([]EventLog{{UUID: 2, LamportTimestamp: now.UnixNano(), EventType: UpdateEvent, ListItemKey: "1:2", Line: "1:2"}})
+
+		pruned := repo.collectGarbage(now)
+		if len(pruned) != 1 || pruned[0] != "1:3" {
+			t.Fatalf("Expected only 1:3 to be pruned, but got %v", pruned)
+		}
+		if n := repo.crdt.traverse(nil); n == nil || n.key != "1:2" {
+			t.Errorf("1:2 should still be live")
+		}
+	})
+	t.Run("Acks are retained in the wal", func(t *testing.T) {
+		repo := setup()
+		ack(repo, 1, old)
+		ack(repo, 1, now.UnixNano())
+		ack(repo, 1, old+1)
+
+		if a := repo.crdt.ackEventSet[1].LamportTimestamp; a != now.UnixNano() {
+			t.Errorf("Expected most recent ack %d, but got %d", now.UnixNano(), a)
+		}
+		if repo.clock.last > now.UnixNano() {
+			t.Errorf("Acks should not contribute to the clock")
+		}
+
+		b, err := BuildByteWal(repo.crdt.generateEvents())
+		if err != nil {
+			t.Fatal(err)
+		}
+		otherRepo := NewDBListRepo(NewLocalFileWalFile(otherRootDir), NewFileWebTokenStore(otherRootDir))
+		el, err := otherRepo.buildFromFile(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		otherRepo.Replay(el)
+		if a := otherRepo.crdt.ackEventSet[1].LamportTimestamp; a != now.UnixNano() {
+			t.Errorf("Expected ack %d, but got %d", now.UnixNano(), a)
+		}
+	})
+	t.Run("Unknown event types are ignored", func(t *testing.T) {
+		repo := setup()
+		repo.Replay([]EventLog{{UUID: 1, LamportTimestamp: old, EventType: AckEvent + 1, ListItemKey: "1:4"}})
+		if _, exists := repo.listItemCache["1:4"]; exists {
+			t.Errorf("Unknown events should be ignored")
+		}
+	})
+}
+
 //func TestCRDTMergeDeletesReal(t *testing.T) {
 //    repo, clearUp := setupRepo()
 //    repoUUID := uuid(1)
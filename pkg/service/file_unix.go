@@ -0,0 +1,20 @@
+//go:build !windows
+
+package service
+
+import (
+	"os"
+)
+
+// syncDir syncs the directory to disk, which persists the entries for any files created or renamed within it
+func syncDir(dir string) error {
+	if dir == "" {
+		dir = "."
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
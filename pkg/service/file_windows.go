@@ -0,0 +1,9 @@
+//go:build windows
+
+package service
+
+// syncDir is a no-op on Windows, where directories can't be opened for syncing. NTFS journals metadata changes
+// (including renames) itself.
+func syncDir(dir string) error {
+	return nil
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// Event timestamps are hybrid logical clocks (Kulkarni et al., "Logical Physical Clocks", 2014), packed into an
+// int64. The high bits hold the physical component: the wall clock time in nanoseconds, truncated to a multiple of
+// 1<<hlcLogicalBits. The low bits hold the logical counter, which orders events generated within the same physical
+// tick, or after observing a timestamp which is ahead of the local wall clock. Packed timestamps compare in the same
+// way as the (physical, logical) pairs they encode, and remain convertible to wall clock time to within ~65µs.
+const hlcLogicalBits = 16
+
+const hlcLogicalMask = 1<<hlcLogicalBits - 1
+
+// hlcEpoch is the lower bound for timestamps which encode wall clock time. Pure Lamport timestamps from schemas prior
+// to v8 are always far below the epoch, so they order before any HLC timestamp.
+var hlcEpoch = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC).UnixNano()
+
+// maxClockDrift bounds how far ahead of the local wall clock the clock can be moved by timestamps observed from other
+// devices. Without it, a single device with a fast clock would drag the clocks of every device it syncs with into
+// the future, where they'd remain (skewing edit times and tombstone garbage collection). See `nextItemTimestamp`
+// for how local changes still order after events beyond the bound.
+const maxClockDrift = 10 * time.Minute
+
+type hlc struct {
+	sync.Mutex
+	last int64 // the greatest timestamp generated or observed (subject to `maxClockDrift`)
+	now  func() time.Time
+}
+
+func newHLC() *hlc {
+	return &hlc{now: time.Now}
+}
+
+// hlcPhysical returns the physical component of the timestamp
+func hlcPhysical(ts int64) int64 {
+	return ts &^ hlcLogicalMask
+}
+
+// next returns a timestamp for a locally generated event, which is strictly greater than any previously generated
+// or observed timestamp. If the wall clock has moved on, the logical counter is reset, otherwise it's incremented.
+// On the (unlikely) overflow of the counter, it carries into the physical component, which is indistinguishable
+// from the wall clock having ticked.
+func (c *hlc) next() int64 {
+	c.Lock()
+	defer c.Unlock()
+	if pt := hlcPhysical(c.now().UnixNano()); pt > c.last {
+		c.last = pt
+	} else {
+		c.last++
+	}
+	return c.last
+}
+
+// observe merges a timestamp from a processed event into the clock, so subsequent local timestamps order after it.
+// Timestamps more than `maxClockDrift` ahead of the wall clock only move the clock as far as the bound.
+func (c *hlc) observe(ts int64) {
+	c.Lock()
+	defer c.Unlock()
+	if limit := hlcPhysical(c.now().Add(maxClockDrift).UnixNano()); ts > limit {
+		ts = limit
+	}
+	if ts > c.last {
+		c.last = ts
+	}
+}
+
+// wallTime returns the wall clock time encoded in the timestamp, or the zero time if the timestamp is a pure
+// Lamport timestamp
+func wallTime(ts int64) time.Time {
+	if ts < hlcEpoch {
+		return time.Time{}
+	}
+	return time.Unix(0, hlcPhysical(ts))
+}
+
+// nextItemTimestamp returns a timestamp for a locally generated event on an existing item. As the clock is bounded
+// by `maxClockDrift`, the item's current events may have come from a device with a fast clock, and be ahead of it.
+// The local change is the more recent intent, so it's ordered directly after them in that case.
+func (r *DBListRepo) nextItemTimestamp(key string) int64 {
+	ts := r.clock.next()
+	for _, eventSet := range []map[string]EventLog{r.crdt.addEventSet, r.crdt.deleteEventSet, r.crdt.positionEventSet} {
+		if ce, exists := eventSet[key]; exists && ce.LamportTimestamp >= ts {
+			ts = ce.LamportTimestamp + 1
+		}
+	}
+	return ts
+}
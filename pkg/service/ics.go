@@ -0,0 +1,101 @@
+package service
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ICSComponent is the iCalendar component type which dated items are exported as
+type ICSComponent int
+
+const (
+	ICSEvent ICSComponent = iota // all day events, which are supported by most calendar apps
+	ICSTodo                      // tasks, which retain completion state, but aren't supported by some calendar apps
+)
+
+const (
+	icsProdID       = "-//fuzzynote//fzn//EN"
+	icsDateFormat   = "20060102"
+	icsStampFormat  = "20060102T150405Z"
+	icsMaxLineBytes = 75
+)
+
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// writeICSLine writes the content line, folded to the maximum line length, without splitting multi-byte characters
+func writeICSLine(w *bufio.Writer, line string) {
+	limit := icsMaxLineBytes
+	for len(line) > limit {
+		i := limit
+		for i > 0 && !utf8.RuneStart(line[i]) {
+			i--
+		}
+		w.WriteString(line[:i])
+		w.WriteString("\r\n ")
+		line = line[i:]
+		// Continuation lines are prefixed with a space, which counts towards the limit
+		limit = icsMaxLineBytes - 1
+	}
+	w.WriteString(line)
+	w.WriteString("\r\n")
+}
+
+// getICSSummary returns the line with the date removed, as it's conveyed by the date of the component instead
+func getICSSummary(line string) string {
+	if ld, ok := parseLineDate(line); ok {
+		line = line[:ld.start] + line[ld.end:]
+	}
+	return strings.Join(strings.Fields(line), " ")
+}
+
+// ExportICS writes all items with a date (see `GetAgenda`) as an iCalendar, with each item as an all day component.
+// The ListItemKey is used as the UID, so calendar apps update existing components on re-import (or on refresh of a
+// subscription), rather than duplicating them. Archived items are exported as completed tasks, and omitted from
+// events.
+func (r *DBListRepo) ExportICS(w io.Writer, component ICSComponent, now time.Time) error {
+	name, status := "VEVENT", ""
+	bw := bufio.NewWriter(w)
+	writeICSLine(bw, "BEGIN:VCALENDAR")
+	writeICSLine(bw, "VERSION:2.0")
+	writeICSLine(bw, "PRODID:"+icsProdID)
+	writeICSLine(bw, "CALSCALE:GREGORIAN")
+	writeICSLine(bw, "X-WR-CALNAME:fzn")
+	for _, g := range r.GetAgenda(now, component == ICSTodo) {
+		for _, item := range g.Items {
+			stamp := item.LastEditedAt()
+			if stamp.IsZero() {
+				stamp = now
+			}
+			date := item.Date.Format(icsDateFormat)
+
+			if component == ICSTodo {
+				name, status = "VTODO", "NEEDS-ACTION"
+				if item.IsHidden {
+					status = "COMPLETED"
+				}
+			}
+			writeICSLine(bw, "BEGIN:"+name)
+			writeICSLine(bw, "UID:"+item.Key())
+			writeICSLine(bw, "DTSTAMP:"+stamp.UTC().Format(icsStampFormat))
+			writeICSLine(bw, "LAST-MODIFIED:"+stamp.UTC().Format(icsStampFormat))
+			writeICSLine(bw, "SUMMARY:"+icsEscaper.Replace(getICSSummary(item.Line())))
+			if len(item.Note) > 0 {
+				writeICSLine(bw, "DESCRIPTION:"+icsEscaper.Replace(string(item.Note)))
+			}
+			if component == ICSTodo {
+				writeICSLine(bw, "DUE;VALUE=DATE:"+date)
+				writeICSLine(bw, "STATUS:"+status)
+			} else {
+				writeICSLine(bw, "DTSTART;VALUE=DATE:"+date)
+				writeICSLine(bw, "DTEND;VALUE=DATE:"+item.Date.AddDate(0, 0, 1).Format(icsDateFormat))
+				writeICSLine(bw, "TRANSP:TRANSPARENT")
+			}
+			writeICSLine(bw, "END:"+name)
+		}
+	}
+	writeICSLine(bw, "END:VCALENDAR")
+	return bw.Flush()
+}
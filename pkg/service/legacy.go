@@ -11,9 +11,10 @@ import (
 	"strings"
 )
 
+// walItemSchema2 is read with fixed width binary decoding, so the UUIDs need to retain their original width
 type walItemSchema2 struct {
-	UUID                       uuid
-	TargetUUID                 uuid
+	UUID                       uint32
+	TargetUUID                 uint32
 	ListItemCreationTime       int64
 	TargetListItemCreationTime int64
 	EventTime                  int64
@@ -71,6 +72,48 @@ func (e *EventLogSchema6) key() string {
 	return e.cachedKey
 }
 
+// EventLogSchema7 is the gob encoded event of schema v7. The LamportTimestamp is a pure Lamport timestamp (rather
+// than a hybrid logical clock), so v7 events carry no wall clock time.
+type EventLogSchema7 struct {
+	UUID                           uuid // origin UUID
+	LamportTimestamp               int64
+	EventType                      EventType
+	ListItemKey, TargetListItemKey string
+	Line                           string
+	Note                           []byte
+	IsHidden                       bool
+	Friends                        LineFriends
+}
+
+// legacyMigrateFromVersionSeven decodes schema v7 events. Pure Lamport timestamps are retained as-is, as they're
+// required for consistent keys and ordering (and always order before HLC timestamps).
+func legacyMigrateFromVersionSeven(pr *io.PipeReader, errChan chan error) ([]EventLog, error) {
+	var legacyEl []EventLogSchema7
+	dec := gob.NewDecoder(pr)
+	if err := dec.Decode(&legacyEl); err != nil {
+		return []EventLog{}, err
+	}
+	if err := <-errChan; err != nil {
+		return []EventLog{}, err
+	}
+
+	el := make([]EventLog, len(legacyEl))
+	for i, e := range legacyEl {
+		el[i] = EventLog{
+			UUID:              e.UUID,
+			LamportTimestamp:  e.LamportTimestamp,
+			EventType:         e.EventType,
+			ListItemKey:       e.ListItemKey,
+			TargetListItemKey: e.TargetListItemKey,
+			Line:              e.Line,
+			Note:              e.Note,
+			IsHidden:          e.IsHidden,
+			Friends:           e.Friends,
+		}
+	}
+	return el, nil
+}
+
 type LegacyListItem struct {
 	rawLine string
 	Note    []byte
@@ -101,7 +144,7 @@ func getNextEventLogFromWalFile(r io.Reader, schemaVersionID uint16) (*EventLogS
 			return nil, err
 		}
 
-		el.UUID = wi.UUID
+		el.UUID = uuid(wi.UUID)
 		el.EventType = wi.EventType
 		el.ListItemKey = strconv.Itoa(int(wi.UUID)) + ":" + strconv.Itoa(int(wi.ListItemCreationTime))
 		el.TargetListItemKey = strconv.Itoa(int(wi.TargetUUID)) + ":" + strconv.Itoa(int(wi.TargetListItemCreationTime))
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const rootLockFileName = ".fzn.lock"
+
+// rootLock coordinates multiple processes (e.g. the terminal client and a script) running against the same root
+// directory. The process which holds the lock is the leader, and is the only process which writes checkpoints to,
+// and removes wals from, the LocalWalFile. Followers continue to write delta wals (and to pull the wals of other
+// processes), so all processes converge, but can't remove wals which another process has yet to pull.
+//
+// The lock file holds the PID of the leader. If the leader exits without releasing the lock (e.g. it crashes), the
+// lock is stale, and is taken over by the next follower to attempt it.
+type rootLock struct {
+	sync.Mutex
+	path string
+	pid  int
+	held bool
+}
+
+func newRootLock(root string) *rootLock {
+	return &rootLock{
+		path: path.Join(root, rootLockFileName),
+		pid:  os.Getpid(),
+	}
+}
+
+func (l *rootLock) readPID() (int, error) {
+	b, err := os.ReadFile(l.path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(b)))
+}
+
+// tryAcquire returns whether the lock is held by this process, acquiring it if it's free or stale
+func (l *rootLock) tryAcquire() bool {
+	l.Lock()
+	defer l.Unlock()
+	if l.held {
+		return true
+	}
+
+	for i := 0; i < 2; i++ {
+		f, err := os.OpenFile(l.path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			_, err = f.WriteString(strconv.Itoa(l.pid))
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(l.path)
+				return false
+			}
+			l.held = true
+			return true
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return false
+		}
+
+		pid, err := l.readPID()
+		if err == nil && pid == l.pid {
+			l.held = true
+			return true
+		}
+		// Unparseable lock files are treated as stale, as the lock is written in a single small write
+		if err == nil && processExists(pid) {
+			return false
+		}
+		// Only remove the stale lock if it hasn't been taken over by another follower in the meantime. The O_EXCL
+		// create on the next iteration ensures only one follower wins the takeover.
+		if stalePID, _ := l.readPID(); stalePID != pid {
+			return false
+		}
+		if err := os.Remove(l.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return false
+		}
+	}
+	return false
+}
+
+func (l *rootLock) isHeld() bool {
+	l.Lock()
+	defer l.Unlock()
+	return l.held
+}
+
+func (l *rootLock) release() {
+	l.Lock()
+	defer l.Unlock()
+	if !l.held {
+		return
+	}
+	l.held = false
+	if pid, err := l.readPID(); err == nil && pid == l.pid {
+		os.Remove(l.path)
+	}
+}
+
+// isLocalLeader returns whether this process is responsible for compacting the LocalWalFile. Non file based local
+// WalFiles aren't shared between processes, so are always led by the current process.
+func (r *DBListRepo) isLocalLeader() bool {
+	if r.rootLock == nil {
+		return true
+	}
+	return r.rootLock.tryAcquire()
+}
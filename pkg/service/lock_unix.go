@@ -0,0 +1,18 @@
+//go:build !windows
+
+package service
+
+import (
+	"errors"
+	"syscall"
+)
+
+// processExists returns whether a process with the PID is running. EPERM indicates that the process exists, but is
+// owned by another user.
+func processExists(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,21 @@
+//go:build windows
+
+package service
+
+import (
+	"os"
+)
+
+// processExists returns whether a process with the PID is running. On Windows, FindProcess fails if the process
+// doesn't exist.
+func processExists(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
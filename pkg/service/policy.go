@@ -0,0 +1,152 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+)
+
+type SyncDirection int
+
+const (
+	SyncBoth     SyncDirection = iota
+	SyncPushOnly               // e.g. a backup, which is never read from
+	SyncPullOnly               // e.g. a mirror of another user's data, which is never written to
+)
+
+func (d SyncDirection) String() string {
+	switch d {
+	case SyncPushOnly:
+		return "push"
+	case SyncPullOnly:
+		return "pull"
+	}
+	return "both"
+}
+
+// ParseSyncDirection parses the direction from config, where an empty string is equivalent to "both"
+func ParseSyncDirection(s string) (SyncDirection, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "both":
+		return SyncBoth, nil
+	case "push":
+		return SyncPushOnly, nil
+	case "pull":
+		return SyncPullOnly, nil
+	}
+	return SyncBoth, fmt.Errorf("invalid sync direction %q, expected one of: push, pull, both", s)
+}
+
+// WalFilePolicy dictates what is synced to and from an owned WalFile. The zero value syncs everything in both
+// directions.
+//
+// Match holds search groups, in the same form as those passed to Match. If set, only events for items which match
+// all groups are pushed to the WalFile (e.g. []string{"#work"}). The filter applies to pushes only, as a pulled
+// event may be for an item which we have yet to see. Items which stop matching are not removed from the WalFile;
+// they are left as they were at the point they last matched.
+type WalFilePolicy struct {
+	Direction SyncDirection
+	Match     []string
+}
+
+func (p WalFilePolicy) canPush() bool {
+	return p.Direction != SyncPullOnly
+}
+
+func (p WalFilePolicy) canPull() bool {
+	return p.Direction != SyncPushOnly
+}
+
+func (p WalFilePolicy) isFiltered() bool {
+	for _, g := range p.Match {
+		if g != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// AddWalFileWithPolicy registers an owned WalFile, which is synced according to the policy
+func (r *DBListRepo) AddWalFileWithPolicy(wf WalFile, p WalFilePolicy) {
+	r.walFilePolicyMut.Lock()
+	if p.Direction != SyncBoth || p.isFiltered() {
+		r.walFilePolicies[wf.GetUUID()] = p
+	} else {
+		delete(r.walFilePolicies, wf.GetUUID())
+	}
+	r.walFilePolicyMut.Unlock()
+
+	r.AddWalFile(wf, true)
+}
+
+func (r *DBListRepo) getWalFilePolicy(wf WalFile) WalFilePolicy {
+	r.walFilePolicyMut.RLock()
+	defer r.walFilePolicyMut.RUnlock()
+	return r.walFilePolicies[wf.GetUUID()]
+}
+
+// lineMatchesPolicy applies the policy search groups to the line, as per Match
+func lineMatchesPolicy(line string, p WalFilePolicy) bool {
+	for _, g := range p.Match {
+		group := []rune(g)
+		pattern, nChars := GetMatchPattern(group)
+		if !isMatch(group[nChars:], line, pattern) {
+			return false
+		}
+	}
+	return true
+}
+
+// itemMatchesPolicy checks the most recent UpdateEvent for the item, as that's where the line state lives
+func (r *DBListRepo) itemMatchesPolicy(key string, p WalFilePolicy) bool {
+	e, exists := r.crdt.addEventSet[key]
+	return exists && lineMatchesPolicy(e.Line, p)
+}
+
+// getPolicyWal returns the subset of events which should be pushed to a WalFile with a filtered policy. As with
+// collaborators, PositionEvents are re-targeted to the nearest matching ancestor, so the item isn't orphaned on
+// the remote. An item might only start matching after it was positioned (e.g. lines added outside of a search,
+// which are then tagged), so we include the current PositionEvent alongside matching UpdateEvents, unless the
+// wal already has one for the item.
+func (r *DBListRepo) getPolicyWal(el []EventLog, p WalFilePolicy) []EventLog {
+	positioned := make(map[string]struct{})
+	for _, e := range el {
+		if e.EventType == PositionEvent {
+			positioned[e.ListItemKey] = struct{}{}
+		}
+	}
+
+	isMatch := func(key string) bool {
+		return r.itemMatchesPolicy(key, p)
+	}
+
+	filteredWal := []EventLog{}
+	for _, e := range el {
+		switch e.EventType {
+		case UpdateEvent:
+			if !lineMatchesPolicy(e.Line, p) {
+				continue
+			}
+			filteredWal = append(filteredWal, e)
+			if _, exists := positioned[e.ListItemKey]; !exists {
+				if pe, exists := r.crdt.positionEventSet[e.ListItemKey]; exists {
+					pe.TargetListItemKey = r.getNearestTargetKey(pe.TargetListItemKey, isMatch)
+					filteredWal = append(filteredWal, pe)
+					positioned[e.ListItemKey] = struct{}{}
+				}
+			}
+		case DeleteEvent:
+			if isMatch(e.ListItemKey) {
+				filteredWal = append(filteredWal, e)
+			}
+		case PositionEvent:
+			if isMatch(e.ListItemKey) {
+				e.TargetListItemKey = r.getNearestTargetKey(e.TargetListItemKey, isMatch)
+				filteredWal = append(filteredWal, e)
+			}
+		default:
+			// AckEvents aren't item specific, and are required for tombstone garbage collection
+			filteredWal = append(filteredWal, e)
+		}
+	}
+	return filteredWal
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"hash/fnv"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// recurrenceRegex matches rules such as `every:day`, `every:2 weeks`, `every:month on 31`, `every:mon` or
+// `every:weekday`. The `every:` marker is required, so lines which happen to contain e.g. "every day" in prose don't
+// recur.
+var recurrenceRegex = regexp.MustCompile(`(?i)(?:^|\s)every:(?:(\d+)\s+)?(day|weekday|week|month|year|mon|tue|wed|thu|fri|sat|sun)[a-z]*\b(?:\s+on\s+(\d{1,2})\b)?`)
+
+// recurrence is a rule parsed from a line. Either interval (with a unit of days, months or years), or weekdays, is
+// set. Monthly and yearly rules may also set the day of the month they fall on, otherwise it's that of the due date.
+type recurrence struct {
+	days, months, years int
+	day                 int
+	weekdays            map[time.Weekday]struct{}
+}
+
+var weekdayPrefixes = map[string]time.Weekday{
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+	"sun": time.Sunday,
+}
+
+func parseRecurrence(line string) (recurrence, bool) {
+	m := recurrenceRegex.FindStringSubmatch(line)
+	if m == nil {
+		return recurrence{}, false
+	}
+	n := 1
+	if m[1] != "" {
+		var err error
+		if n, err = strconv.Atoi(m[1]); err != nil || n < 1 {
+			return recurrence{}, false
+		}
+	}
+	unit := strings.ToLower(m[2])
+	switch unit {
+	case "day":
+		return recurrence{days: n}, true
+	case "week":
+		return recurrence{days: 7 * n}, true
+	case "month":
+		return recurrence{months: n, day: parseRecurrenceDay(m[3])}, true
+	case "year":
+		return recurrence{years: n, day: parseRecurrenceDay(m[3])}, true
+	case "weekday":
+		return recurrence{weekdays: map[time.Weekday]struct{}{
+			time.Monday: {}, time.Tuesday: {}, time.Wednesday: {}, time.Thursday: {}, time.Friday: {},
+		}}, true
+	}
+	// Intervals don't apply to named days (e.g. `every:2 mon`)
+	if m[1] != "" {
+		return recurrence{}, false
+	}
+	return recurrence{weekdays: map[time.Weekday]struct{}{weekdayPrefixes[unit]: {}}}, true
+}
+
+// parseRecurrenceDay returns the day of the month from the rule, or 0 if it isn't set (or isn't a valid day)
+func parseRecurrenceDay(s string) int {
+	if d, err := strconv.Atoi(s); err == nil && d >= 1 && d <= 31 {
+		return d
+	}
+	return 0
+}
+
+// next returns the next due date after the given due date, which is always in the future relative to today, so
+// items completed late don't regenerate already overdue copies
+func (rc recurrence) next(due time.Time, today time.Time) time.Time {
+	if len(rc.weekdays) > 0 {
+		d := due
+		if today.After(d) {
+			d = today
+		}
+		for {
+			d = d.AddDate(0, 0, 1)
+			if _, ok := rc.weekdays[d.Weekday()]; ok {
+				return d
+			}
+		}
+	}
+	// Occurrences fall on the rule's day of the month, clamped to the end of shorter months. The day is retained in
+	// the rule of clamped occurrences (see `getRecurrenceEvents`), so they don't drift (e.g. Jan 31 recurs on Feb 28,
+	// then Mar 31).
+	months := 12*rc.years + rc.months
+	day := rc.day
+	if day == 0 {
+		day = due.Day()
+	}
+	for i := 1; ; i++ {
+		d := addMonths(due, i*months, day).AddDate(0, 0, i*rc.days)
+		if d.After(today) {
+			return d
+		}
+	}
+}
+
+// addMonths adds the given number of months to t, and sets the day of the month, clamping to the last day of the
+// resulting month, rather than overflowing into the next as time.AddDate does (e.g. Jan 31 + 1 month is Feb 28, not
+// Mar 3)
+func addMonths(t time.Time, months int, d int) time.Time {
+	y, m, _ := t.Date()
+	first := time.Date(y, m+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	if last := first.AddDate(0, 1, -1).Day(); d > last {
+		d = last
+	}
+	return first.AddDate(0, 0, d-1)
+}
+
+// getRecurrenceKey returns the key of the item generated when the item with the given key recurs. The key is
+// derived from the source key, so if the item is completed on multiple devices concurrently, each generates events
+// for the same item, which are merged, rather than creating duplicates.
+func getRecurrenceKey(key string) string {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	ts := ""
+	if i := strings.LastIndex(key, ":"); i >= 0 {
+		ts = key[i+1:]
+	}
+	return strconv.FormatUint(h.Sum64(), 10) + ":" + ts
+}
+
+// getRecurrenceEvents returns the events to generate the next occurrence of the item, if it has a recurrence rule,
+// along with the events to undo them. The new item is positioned alongside the original, with the date in the line
+// set to the next due date (or appended, if the line has no date). If the next date is clamped to the end of a
+// shorter month, the day of the month is added to the rule, so subsequent occurrences don't drift. Each item only has a single next occurrence, so
+// hiding the original again (e.g. after un-hiding it) doesn't generate another copy, unless the previous one was
+// deleted (e.g. via undo), in which case it's restored.
+func (r *DBListRepo) getRecurrenceEvents(item *ListItem, now time.Time) ([]EventLog, []EventLog) {
+	line := item.Line()
+	rc, ok := parseRecurrence(line)
+	if !ok {
+		return nil, nil
+	}
+
+	key := getRecurrenceKey(item.key)
+	if r.crdt.itemIsLive(key) {
+		return nil, nil
+	}
+
+	today := startOfDay(now)
+	due := today
+	ld, hasDate := parseLineDate(line)
+	if hasDate {
+		due = ld.date
+	}
+	next := rc.next(due, today)
+
+	newLine := line
+	if rc.day == 0 && next.Day() != due.Day() && rc.months+rc.years > 0 {
+		end := recurrenceRegex.FindStringIndex(line)[1]
+		day := " on " + strconv.Itoa(due.Day())
+		newLine = line[:end] + day + line[end:]
+		if hasDate && end <= ld.start {
+			ld.start += len(day)
+			ld.end += len(day)
+		}
+	}
+	if hasDate {
+		newLine = newLine[:ld.start] + next.Format(ld.layout) + newLine[ld.end:]
+	} else {
+		newLine = strings.TrimRight(newLine, " ") + " " + next.Format(dateFormat)
+	}
+
+	e := r.newEventLog(UpdateEvent)
+	e.ListItemKey = key
+	// Retain any friends, which are stored at the end of the raw line
+	e.Line = newLine + item.rawLine[len(line):]
+	e.Note = item.Note
+	e.Attachments = item.attachments
+
+	pe := r.newEventLog(PositionEvent)
+	pe.ListItemKey = key
+	pe.TargetListItemKey = item.key
+
+	de := r.newEventLog(DeleteEvent)
+	de.ListItemKey = key
+
+	return []EventLog{e, pe}, []EventLog{de}
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLineDate(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected string
+		ok       bool
+	}{
+		{"pay rent 2022-03-01", "2022-03-01", true},
+		{"standup Tue, Mar 01, 2022 notes", "2022-03-01", true},
+		{"no date here", "", false},
+		{"invalid 2022-13-45", "", false},
+		{"mismatched weekday Mon, Mar 01, 2022", "", false},
+		{"first valid 2022-13-45 2022-03-02", "2022-03-02", true},
+	}
+	for _, tt := range tests {
+		ld, ok := parseLineDate(tt.line)
+		if ok != tt.ok {
+			t.Errorf("%q: expected ok %v, got %v", tt.line, tt.ok, ok)
+			continue
+		}
+		if ok && ld.date.Format(isoDateFormat) != tt.expected {
+			t.Errorf("%q: expected %s, got %s", tt.line, tt.expected, ld.date.Format(isoDateFormat))
+		}
+	}
+}
+
+func TestRecurrenceNext(t *testing.T) {
+	// Tuesday
+	today := time.Date(2022, time.March, 1, 0, 0, 0, 0, time.Local)
+	tests := []struct {
+		line     string
+		due      time.Time
+		expected string
+	}{
+		{"every:day", today, "2022-03-02"},
+		{"every:2 weeks", today, "2022-03-15"},
+		{"every:month", today, "2022-04-01"},
+		{"every:year", today, "2023-03-01"},
+		{"every:mon", today, "2022-03-07"},
+		{"every:Friday", today, "2022-03-04"},
+		{"every:weekday", today.AddDate(0, 0, 3), "2022-03-07"},
+		// Overdue items skip to the next occurrence after today
+		{"every:day", today.AddDate(0, 0, -5), "2022-03-02"},
+		{"every:week", today.AddDate(0, 0, -7), "2022-03-08"},
+		// Items completed early recur relative to the due date
+		{"every:week", today.AddDate(0, 0, 2), "2022-03-10"},
+		// Months and years are clamped to the end of shorter months
+		{"every:month", time.Date(2022, time.January, 31, 0, 0, 0, 0, time.Local), "2022-03-31"},
+		{"every:year", time.Date(2020, time.February, 29, 0, 0, 0, 0, time.Local), "2023-02-28"},
+		// The day of the month can be set explicitly, e.g. for occurrences which have been clamped
+		{"every:month on 31", time.Date(2022, time.February, 28, 0, 0, 0, 0, time.Local), "2022-03-31"},
+		{"every:month on 15", today, "2022-04-15"},
+		{"every:year on 29", time.Date(2023, time.February, 28, 0, 0, 0, 0, time.Local), "2024-02-29"},
+		{"pay rent every:month", today, "2022-04-01"},
+	}
+	for _, tt := range tests {
+		rc, ok := parseRecurrence(tt.line)
+		if !ok {
+			t.Errorf("%q: expected a recurrence", tt.line)
+			continue
+		}
+		if next := rc.next(tt.due, today).Format(isoDateFormat); next != tt.expected {
+			t.Errorf("%q from %s: expected %s, got %s", tt.line, tt.due.Format(isoDateFormat), tt.expected, next)
+		}
+	}
+
+	if rc, _ := parseRecurrence("every:month on 2022-03-01"); rc.day != 0 {
+		t.Errorf("Dates should not be parsed as the day of the month, got %d", rc.day)
+	}
+
+	for _, line := range []string{"every:", "every:0 days", "every:2 mon", "every day", "finish every day", "nevery:day"} {
+		if _, ok := parseRecurrence(line); ok {
+			t.Errorf("%q: expected no recurrence", line)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"fmt"
+	"time"
+)
+
+type RemoteOp string
+
+const (
+	RemoteOpList   RemoteOp = "list"
+	RemoteOpGet    RemoteOp = "get"
+	RemoteOpFlush  RemoteOp = "flush"
+	RemoteOpRemove RemoteOp = "remove"
+)
+
+// per-remote backoff bounds, applied after consecutive failed operations
+const (
+	minRemoteBackoff = time.Second * 5
+	maxRemoteBackoff = time.Minute * 5
+)
+
+// RemoteError wraps an error returned from a WalFile operation, identifying the WalFile and operation. WalFile
+// implementations should return errors rather than exiting, which allows the repo to back off the individual
+// remote and surface the error to the client (see SyncErrorEvent), whilst other remotes continue to sync.
+type RemoteError struct {
+	WalFile string // the WalFile UUID
+	Kind    string
+	Op      RemoteOp
+	Err     error
+}
+
+func newRemoteError(wf WalFile, op RemoteOp, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &RemoteError{
+		WalFile: wf.GetUUID(),
+		Kind:    walFileKind(wf),
+		Op:      op,
+		Err:     err,
+	}
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("%s remote %q: %s failed: %v", e.Kind, e.WalFile, e.Op, e.Err)
+}
+
+func (e *RemoteError) Unwrap() error {
+	return e.Err
+}
+
+// SyncErrorEvent is emitted to the Client when a remote starts failing. Subsequent failures are not emitted until
+// the remote has recovered, see GetSyncStatus for the ongoing state.
+type SyncErrorEvent struct {
+	Err error
+}
+
+// nextRemoteBackoff doubles the backoff, within the bounds
+func nextRemoteBackoff(cur time.Duration) time.Duration {
+	if cur < minRemoteBackoff {
+		return minRemoteBackoff
+	}
+	if cur *= 2; cur > maxRemoteBackoff {
+		return maxRemoteBackoff
+	}
+	return cur
+}
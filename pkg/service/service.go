@@ -3,19 +3,19 @@ package service
 import (
 	"errors"
 	"sort"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
 type (
-	uuid         uint32
+	uuid         uint64
 	fileSchemaID uint16
 )
 
 const (
 	walFilePattern    = "wal_%v.db"
+	blobFilePattern   = "blob_%v"
 	viewFilePattern   = "view_%v"
 	exportFilePattern = "export_%v.txt"
 )
@@ -40,13 +40,14 @@ type DBListRepo struct {
 	eventLogger    *DbEventLogger
 	matchListItems map[string]*ListItem
 
-	currentLamportTimestamp int64
-	listItemCache           map[string]*ListItem
+	clock         *hlc
+	listItemCache map[string]*ListItem
 
 	crdt *crdtTree
 
 	// Wal stuff
 	uuid       uuid
+	device     Device
 	eventsChan chan EventLog
 	web        *Web
 
@@ -59,6 +60,7 @@ type DBListRepo struct {
 	email string
 	//cfgFriendRegex            *regexp.Regexp
 	friends                       map[string]map[string]int64
+	readOnlyFriends               map[string]map[string]int64 // map[email]map[configItemKey]timestamp, for config lines granting read-only access
 	friendsUpdateLock             *sync.RWMutex
 	friendsOrdered                []string            // operating sort of like a queue, with earliest friends at the head
 	activeFriends, pendingFriends map[string]struct{} // returned from the cloud
@@ -75,26 +77,54 @@ type DBListRepo struct {
 	allWalFileMut  *sync.RWMutex
 	syncWalFileMut *sync.RWMutex
 
+	walFilePolicies  map[string]WalFilePolicy // owned WalFiles which aren't synced in full
+	walFilePolicyMut *sync.RWMutex
+
 	processedWalChecksums    map[string]struct{}
+	pushedWals               map[string]struct{} // the wals pushed by this process, a subset of the above
 	processedWalChecksumLock *sync.Mutex
 
+	compaction       *compactionTracker
+	tombstoneHorizon time.Duration
+	lastAck          time.Time
+	syncStatus       *syncStatusTracker
+	rootLock         *rootLock
+	backupRetention  int
+
 	pushTriggerTimer   *time.Timer
 	hasUnflushedEvents bool
 	finalFlushChan     chan struct{}
+	forwardChan        chan forwardedWal
+	webLoopDone        chan struct{} // closed once the web loop exits, after which it no longer flushes tokens
 
 	hasSyncedRemotes bool
+	isWatchingLocal  bool // local changes are flushed to the LocalWalFile on publish, see `watchLocalWalFile`
 
 	isTest bool
 }
 
 // NewDBListRepo returns a pointer to a new instance of DBListRepo
 func NewDBListRepo(localWalFile LocalWalFile, webTokenStore WebTokenStore) *DBListRepo {
+	// Each process generates its own origin UUID, see `Device`. Only file based local walfiles are able to persist
+	// the device identity. Otherwise (or on failure), we fall back to an ephemeral identity for the lifetime of the
+	// process.
+	device := Device{ID: generateUUID()}
+	var lock *rootLock
+	if wf, ok := localWalFile.(*LocalFileWalFile); ok {
+		if d, err := getOrCreateDevice(wf.GetRoot()); err == nil {
+			device = d
+		}
+		lock = newRootLock(wf.GetRoot())
+	}
+
 	listRepo := &DBListRepo{
 		// TODO rename this cos it's solely for UNDO/REDO
 		eventLogger: NewDbEventLogger(),
 
 		// Wal stuff
 		uuid:          generateUUID(),
+		clock:         newHLC(),
+		device:        device,
 		listItemCache: make(map[string]*ListItem),
 
 		crdt: newTree(),
@@ -111,15 +141,28 @@ func NewDBListRepo(localWalFile LocalWalFile, webTokenStore WebTokenStore) *DBLi
 		allWalFileMut:  &sync.RWMutex{},
 		syncWalFileMut: &sync.RWMutex{},
 
+		walFilePolicies:  make(map[string]WalFilePolicy),
+		walFilePolicyMut: &sync.RWMutex{},
+
 		processedWalChecksums:    make(map[string]struct{}),
+		pushedWals:               make(map[string]struct{}),
 		processedWalChecksumLock: &sync.Mutex{},
 
+		compaction:       newCompactionTracker(DefaultCompactionConfig),
+		tombstoneHorizon: DefaultTombstoneHorizon,
+		syncStatus:       newSyncStatusTracker(),
+		rootLock:         lock,
+		backupRetention:  DefaultBackupRetention,
+
 		friends:              make(map[string]map[string]int64),
+		readOnlyFriends:      make(map[string]map[string]int64),
 		friendsUpdateLock:    &sync.RWMutex{},
 		activeFriendsMapLock: &sync.RWMutex{},
 
 		pushTriggerTimer: time.NewTimer(time.Second * 0),
 		finalFlushChan:   make(chan struct{}),
+		forwardChan:      make(chan forwardedWal),
+		webLoopDone:      make(chan struct{}),
 	}
 
 	// The localWalFile gets attached to the Wal independently (there are certain operations
@@ -176,7 +219,12 @@ type ListItem struct {
 	matchChild  *ListItem
 	matchParent *ListItem
 
-	friends LineFriends
+	friends     LineFriends
+	attachments []Attachment
+
+	lastEditedBy string
+	lastEditedOn uuid
+	lastEditedAt int64
 
 	localEmail string // set at creation time and used to exclude from Friends() method
 	key        string
@@ -204,6 +252,17 @@ func (i *ListItem) Friends() []string {
 	return sortedEmails
 }
 
+// LastEditedBy returns the email of the user who last edited the item, or an empty string if it was edited
+// whilst logged out (or prior to attribution being recorded)
+func (i *ListItem) LastEditedBy() string {
+	return i.lastEditedBy
+}
+
+// LastEditedAt returns the time of the last edit, derived from the event timestamp, or the zero time if unknown
+func (i *ListItem) LastEditedAt() time.Time {
+	return wallTime(i.lastEditedAt)
+}
+
 // TODO make attribute public directly??
 func (i *ListItem) Key() string {
 	return i.key
@@ -257,7 +316,7 @@ func (r *DBListRepo) Add(line string, note []byte, childItem *ListItem) (string,
 	var events []EventLog
 
 	e := r.newEventLog(UpdateEvent)
-	e.ListItemKey = strconv.Itoa(int(e.UUID)) + ":" + strconv.Itoa(int(e.LamportTimestamp))
+	e.ListItemKey = e.key()
 	e.Line = line
 	e.Note = note
 	newItem, _ := r.addEventLog(e)
@@ -283,6 +342,11 @@ func (r *DBListRepo) Update(line string, item *ListItem) error {
 	return nil
 }
 
+// SetLine updates the line of an existing ListItem, as returned by Line(), retaining any friends
+func (r *DBListRepo) SetLine(line string, item *ListItem) error {
+	return r.Update(line+item.rawLine[len(item.Line()):], item)
+}
+
 // TODO rethink this interface
 func (r *DBListRepo) UpdateNote(note []byte, item *ListItem) error {
 	e := r.updateNote(note, item)
@@ -384,11 +448,21 @@ func (r *DBListRepo) ToggleVisibility(item *ListItem) (string, error) {
 	}
 	e := r.newEventLogFromListItem(UpdateEvent, item)
 	e.IsHidden = newIsHidden
-	r.addEventLog(e)
-
 	ue := r.newEventLogFromListItem(UpdateEvent, item)
 	ue.IsHidden = !newIsHidden
-	r.addUndoLogs([]EventLog{ue}, []EventLog{e})
+	events, undoEvents := []EventLog{e}, []EventLog{ue}
+
+	// Completing a recurring item generates the next occurrence
+	if newIsHidden {
+		recurEvents, recurUndoEvents := r.getRecurrenceEvents(item, time.Now())
+		events = append(events, recurEvents...)
+		undoEvents = append(undoEvents, recurUndoEvents...)
+	}
+
+	for _, e := range events {
+		r.addEventLog(e)
+	}
+	r.addUndoLogs(undoEvents, events)
 
 	return focusedItemKey, nil
 }
@@ -400,7 +474,7 @@ func (r *DBListRepo) replayEventsFromUndoLog(events []EventLog) string {
 	// to the old ListItem in the caches
 	var key string
 	for i, e := range events {
-		e.LamportTimestamp = r.currentLamportTimestamp
+		e.LamportTimestamp = r.nextItemTimestamp(e.ListItemKey)
 		item, _ := r.addEventLog(e)
 		if i == 0 && item != nil {
 			if c := item.matchChild; e.EventType == DeleteEvent && c != nil {
@@ -532,7 +606,8 @@ func (r *DBListRepo) Match(keys [][]rune, showHidden bool, curKey string, offset
 
 func (r *DBListRepo) GetFriendFromConfig(item ListItem) (string, bool) {
 	if fields, isConfig := r.checkIfConfigLine(item.rawLine); isConfig {
-		return string(fields[1]), true
+		email, _ := parseConfigFriend(fields[1])
+		return email, true
 	}
 	return "", false
 }
@@ -568,7 +643,7 @@ const (
 type SyncEvent struct{}
 
 func (r *DBListRepo) GetSyncState() SyncState {
-	if !r.web.isActive {
+	if !r.web.active() {
 		return SyncOffline
 	}
 
@@ -595,7 +670,7 @@ func (r *DBListRepo) EmitCursorMoveEvent(key string) {
 	// 2. process it, trigger a client refresh
 	// 3. which calls this function, which then emits an event
 	// 4. trigger stage 1 on remote...
-	if r.web.isActive && r.web.wsConn != nil {
+	if r.web.isConnected() {
 		if key != r.previousListItemKey {
 			//log.Println("cursor move: ", key)
 			go func() {
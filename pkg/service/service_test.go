@@ -1,15 +1,23 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
 	"path/filepath"
+	"runtime"
 
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 var (
@@ -64,19 +72,8 @@ func setupRepo() (*DBListRepo, func()) {
 		}()
 		<-closeChan
 
-		walPathPattern := fmt.Sprintf(path.Join(rootDir, walFilePattern), "*")
-		wals, _ := filepath.Glob(walPathPattern)
-		for _, wal := range wals {
-			os.Remove(wal)
-		}
-		walPathPattern = fmt.Sprintf(path.Join(otherRootDir, walFilePattern), "*")
-		wals, _ = filepath.Glob(walPathPattern)
-		for _, wal := range wals {
-			os.Remove(wal)
-		}
-
-		os.Remove(rootDir)
-		os.Remove(otherRootDir)
+		os.RemoveAll(rootDir)
+		os.RemoveAll(otherRootDir)
 	}
 
 	return repo, closeFn
@@ -890,6 +887,43 @@ func TestServiceUpdate(t *testing.T) {
 			t.Errorf("Expected %s but got %s", expectedLine, matches[1].Line())
 		}
 	})
+	t.Run("Update records author attribution", func(t *testing.T) {
+		repo, clearUp := setupRepo()
+		defer clearUp()
+
+		email := "joe@bloggs.com"
+		repo.setEmail(email)
+
+		// Timestamps only retain the physical component of the clock to within ~65µs
+		before := wallTime(hlcPhysical(time.Now().UnixNano()))
+		repo.Add("New item", nil, nil)
+
+		matches, _, _ := repo.Match([][]rune{}, true, "", 0, 0)
+		if by := matches[0].LastEditedBy(); by != email {
+			t.Errorf("Expected last editor %s but got %s", email, by)
+		}
+		if at := matches[0].LastEditedAt(); at.Before(before) || at.After(time.Now()) {
+			t.Errorf("Unexpected last edit time %v", at)
+		}
+
+		// Remote edits should be attributed to the remote author
+		otherEmail := "jane@bloggs.com"
+		repo.Replay([]EventLog{
+			{
+				UUID:             repo.uuid + 1,
+				LamportTimestamp: repo.clock.next(),
+				EventType:        UpdateEvent,
+				ListItemKey:      matches[0].Key(),
+				Line:             "Remote edit",
+				AuthorEmail:      otherEmail,
+			},
+		})
+
+		matches, _, _ = repo.Match([][]rune{}, true, "", 0, 0)
+		if by := matches[0].LastEditedBy(); by != otherEmail {
+			t.Errorf("Expected last editor %s but got %s", otherEmail, by)
+		}
+	})
 }
 
 func TestServiceMatch(t *testing.T) {
@@ -1292,3 +1326,1156 @@ func TestServiceMatch(t *testing.T) {
 		}
 	})
 }
+
+func TestServiceAttachment(t *testing.T) {
+	t.Run("Add and retrieve attachment", func(t *testing.T) {
+		repo, clearUp := setupRepo()
+		defer clearUp()
+
+		repo.Add("Item with attachment", nil, nil)
+		matches, _, _ := repo.Match([][]rune{}, true, "", 0, 0)
+		item := matches[0]
+
+		content := []byte("attachment content")
+		if err := repo.AddAttachment(context.Background(), &item, "/some/dir/file.txt", bytes.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+
+		blobPathPattern := fmt.Sprintf(path.Join(rootDir, blobFilePattern), "*")
+		defer func() {
+			blobs, _ := filepath.Glob(blobPathPattern)
+			for _, b := range blobs {
+				os.Remove(b)
+			}
+		}()
+
+		matches, _, _ = repo.Match([][]rune{}, true, "", 0, 0)
+		attachments := matches[0].Attachments()
+		if len(attachments) != 1 {
+			t.Fatalf("Item should have 1 attachment but has %d", len(attachments))
+		}
+		a := attachments[0]
+		if a.Name != "file.txt" {
+			t.Errorf("Expected name file.txt but got %s", a.Name)
+		}
+		if a.Size != int64(len(content)) {
+			t.Errorf("Expected size %d but got %d", len(content), a.Size)
+		}
+
+		var b bytes.Buffer
+		if err := repo.GetAttachment(context.Background(), a, &b); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != string(content) {
+			t.Errorf("Expected content %s but got %s", content, b.String())
+		}
+
+		// Undo should remove the reference, but retain the blob
+		repo.Undo()
+		matches, _, _ = repo.Match([][]rune{}, true, "", 0, 0)
+		if len(matches[0].Attachments()) != 0 {
+			t.Errorf("Attachment should have been removed by undo")
+		}
+		if blobs, _ := filepath.Glob(blobPathPattern); len(blobs) != 1 {
+			t.Errorf("Blob should be retained after undo")
+		}
+	})
+	t.Run("Retrieve attachment from remote", func(t *testing.T) {
+		repo, clearUp := setupRepo()
+		defer clearUp()
+
+		os.Mkdir(otherRootDir, os.ModePerm)
+		defer os.RemoveAll(otherRootDir)
+		remote := NewLocalFileWalFile(otherRootDir)
+		repo.AddWalFile(remote, true)
+
+		repo.Add("Item with attachment", nil, nil)
+		matches, _, _ := repo.Match([][]rune{}, true, "", 0, 0)
+		item := matches[0]
+
+		content := []byte("remote attachment content")
+		if err := repo.AddAttachment(context.Background(), &item, "file.txt", bytes.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+		matches, _, _ = repo.Match([][]rune{}, true, "", 0, 0)
+		a := matches[0].Attachments()[0]
+
+		// Simulate the blob only existing on the remote
+		if err := copyBlob(context.Background(), repo.LocalWalFile.(BlobWalFile), remote, a.Checksum); err != nil {
+			t.Fatal(err)
+		}
+		localBlob := fmt.Sprintf(path.Join(rootDir, blobFilePattern), a.Checksum)
+		os.Remove(localBlob)
+		defer os.Remove(localBlob)
+
+		var b bytes.Buffer
+		if err := repo.GetAttachment(context.Background(), a, &b); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != string(content) {
+			t.Errorf("Expected content %s but got %s", content, b.String())
+		}
+		if _, err := os.Stat(localBlob); err != nil {
+			t.Errorf("Blob should be cached locally after retrieval: %v", err)
+		}
+	})
+}
+
+func TestServiceDevice(t *testing.T) {
+	t.Run("Device identity is persisted", func(t *testing.T) {
+		os.Mkdir(rootDir, os.ModePerm)
+		defer os.Remove(path.Join(rootDir, deviceFileName))
+
+		repo := NewDBListRepo(NewLocalFileWalFile(rootDir), NewFileWebTokenStore(rootDir))
+		otherRepo := NewDBListRepo(NewLocalFileWalFile(rootDir), NewFileWebTokenStore(rootDir))
+
+		if repo.Device().ID != otherRepo.Device().ID {
+			t.Errorf("Device ID should be stable across instances, got %d and %d", repo.Device().ID, otherRepo.Device().ID)
+		}
+		// Processes sharing the root must not share an origin, otherwise their item keys can collide
+		if repo.uuid == otherRepo.uuid || repo.uuid == repo.Device().ID {
+			t.Errorf("Repo uuids should be unique per process, got %d and %d", repo.uuid, otherRepo.uuid)
+		}
+		if hostname, _ := os.Hostname(); repo.Device().Name != hostname {
+			t.Errorf("Expected device name %s but got %s", hostname, repo.Device().Name)
+		}
+	})
+	t.Run("Device identity is ephemeral without a root directory", func(t *testing.T) {
+		repo := NewDBListRepo(NewLocalFileWalFile(otherRootDir), NewFileWebTokenStore(otherRootDir))
+		otherRepo := NewDBListRepo(NewLocalFileWalFile(otherRootDir), NewFileWebTokenStore(otherRootDir))
+
+		if repo.Device().ID == otherRepo.Device().ID {
+			t.Errorf("Device IDs should differ if they can't be persisted")
+		}
+	})
+	t.Run("Events record the device", func(t *testing.T) {
+		repo := NewDBListRepo(NewLocalFileWalFile(t.TempDir()), NewFileWebTokenStore(otherRootDir))
+		otherRepo := NewDBListRepo(NewLocalFileWalFile(t.TempDir()), NewFileWebTokenStore(otherRootDir))
+		otherRepo.device.Name = "other"
+
+		e := otherRepo.newEventLog(UpdateEvent)
+		e.ListItemKey = e.key()
+		if e.DeviceID != otherRepo.Device().ID {
+			t.Fatalf("Expected device %d but got %d", otherRepo.Device().ID, e.DeviceID)
+		}
+		repo.Replay([]EventLog{e})
+		item := repo.listItemCache[e.ListItemKey]
+		if name := repo.LastEditedOn(item); name != "" {
+			t.Errorf("The device name shouldn't be known before the device acks, got %s", name)
+		}
+
+		// Names are shared via acks
+		repo.Replay([]EventLog{otherRepo.newAckEvent(0)})
+		if name := repo.LastEditedOn(item); name != "other" {
+			t.Errorf("Expected device name other but got %s", name)
+		}
+
+		local := repo.newEventLog(UpdateEvent)
+		local.ListItemKey = e.ListItemKey
+		repo.Replay([]EventLog{local})
+		if name := repo.LastEditedOn(item); name != repo.Device().Name {
+			t.Errorf("Expected device name %s but got %s", repo.Device().Name, name)
+		}
+	})
+	t.Run("Ties are broken by device", func(t *testing.T) {
+		a := EventLog{UUID: 2, LamportTimestamp: 1, DeviceID: 1}
+		b := EventLog{UUID: 1, LamportTimestamp: 1, DeviceID: 2}
+		if checkEquality(a, b) != leftEventOlder || checkEquality(b, a) != rightEventOlder {
+			t.Errorf("Expected the lower device to order first")
+		}
+		// Processes on the same device are ordered by origin
+		b.DeviceID = 1
+		if checkEquality(b, a) != leftEventOlder {
+			t.Errorf("Expected the lower origin to order first")
+		}
+		if checkEquality(a, a) != eventsEqual {
+			t.Errorf("Expected identical events to be equal")
+		}
+	})
+}
+
+// remoteWalFile is a file based WalFile with a distinct UUID, so it can be registered alongside the LocalWalFile
+type remoteWalFile struct {
+	*LocalFileWalFile
+}
+
+func (wf *remoteWalFile) GetUUID() string {
+	return "remote"
+}
+
+func TestServiceSyncStatus(t *testing.T) {
+	t.Run("Status is tracked per WalFile", func(t *testing.T) {
+		ctx := context.Background()
+		repo := NewDBListRepo(NewLocalFileWalFile(otherRootDir), NewFileWebTokenStore(otherRootDir))
+		repo.SetCompactionConfig(CompactionConfig{MaxDeltaEvents: 100})
+
+		remote := &remoteWalFile{NewLocalFileWalFile(t.TempDir())}
+		repo.AddWalFile(remote, true)
+
+		e := repo.newEventLog(UpdateEvent)
+		e.ListItemKey = "1:1"
+		repo.Replay([]EventLog{e})
+
+		// The local walfile root doesn't exist, so pushes to it will fail
+		repo.gather(ctx)
+		repo.flushPartialWals(ctx, []EventLog{e}, true)
+
+		status := repo.GetSyncStatus()
+		if len(status.WalFiles) != 2 {
+			t.Fatalf("Expected 2 walfiles but got %d", len(status.WalFiles))
+		}
+		local, other := status.WalFiles[0], status.WalFiles[1]
+		if local.Kind != "local" || local.UUID != repo.LocalWalFile.GetUUID() {
+			t.Errorf("Expected the local walfile first, but got %v", local)
+		}
+		if local.LastError == nil || !local.LastPush.IsZero() {
+			t.Errorf("Local walfile push should have failed")
+		}
+		if local.UnpushedEvents != 1 {
+			t.Errorf("Expected 1 unpushed event but got %d", local.UnpushedEvents)
+		}
+		if other.LastError != nil || other.LastPush.IsZero() || other.UnpushedEvents != 0 {
+			t.Errorf("Remote push should have succeeded, got %v", other)
+		}
+		if other.Kind != "service" || !other.IsOwned {
+			t.Errorf("Unexpected remote status %v", other)
+		}
+
+		if _, err := repo.pullAll(ctx, []WalFile{remote}, make(chan namedWal, 10)); err != nil {
+			t.Fatal(err)
+		}
+		if status := repo.GetSyncStatus(); status.WalFiles[1].LastPull.IsZero() {
+			t.Errorf("Remote pull should have been recorded")
+		}
+	})
+	t.Run("Failed deltas force a checkpoint", func(t *testing.T) {
+		ctx := context.Background()
+		repo := NewDBListRepo(NewLocalFileWalFile(otherRootDir), NewFileWebTokenStore(otherRootDir))
+		repo.SetCompactionConfig(CompactionConfig{MaxDeltaEvents: 100})
+
+		remote := &remoteWalFile{NewLocalFileWalFile(t.TempDir())}
+		repo.AddWalFile(remote, true)
+		repo.gather(ctx)
+		if repo.checkpointDue(ctx, remote, false) {
+			t.Fatal("Checkpoint should not be due")
+		}
+
+		repo.syncStatus.recordPush(remote, 1, false, errors.New("failed"))
+		if !repo.checkpointDue(ctx, remote, false) {
+			t.Fatal("Checkpoint should be due")
+		}
+		// Expire the backoff
+		repo.syncStatus.walFiles[remote.GetUUID()].RetryAt = time.Now()
+		repo.gather(ctx)
+		if repo.checkpointDue(ctx, remote, false) {
+			t.Fatal("Checkpoint should no longer be due")
+		}
+	})
+	t.Run("Failed blob pushes force a checkpoint", func(t *testing.T) {
+		ctx := context.Background()
+		repo := NewDBListRepo(NewLocalFileWalFile(t.TempDir()), NewFileWebTokenStore(otherRootDir))
+		repo.SetCompactionConfig(CompactionConfig{MaxDeltaEvents: 100})
+
+		checksum := "abc"
+		if err := repo.LocalWalFile.(BlobWalFile).FlushBlob(ctx, strings.NewReader("blob"), checksum); err != nil {
+			t.Fatal(err)
+		}
+		e := repo.newEventLog(UpdateEvent)
+		e.ListItemKey = "1:1"
+		e.Attachments = []Attachment{{Name: "file.txt", Checksum: checksum}}
+		pe := repo.newEventLog(PositionEvent)
+		pe.ListItemKey = e.ListItemKey
+		repo.Replay([]EventLog{e, pe})
+
+		remote := &failingBlobWalFile{remoteWalFile: &remoteWalFile{NewLocalFileWalFile(t.TempDir())}, err: errors.New("failed")}
+		repo.AddWalFile(remote, true)
+		repo.gather(ctx)
+		if wals, _ := remote.GetMatchingWals(ctx, path.Join(remote.GetRoot(), "wal_*.db")); len(wals) != 1 {
+			t.Errorf("Expected the checkpoint to be pushed, got %v", wals)
+		}
+		if !repo.syncStatus.hasUnpushedEvents(remote) || repo.GetSyncStatus().WalFiles[1].LastError == nil {
+			t.Fatal("Events should remain unpushed after the blob push failed")
+		}
+
+		remote.err = nil
+		repo.syncStatus.walFiles[remote.GetUUID()].RetryAt = time.Now()
+		repo.gather(ctx)
+		if repo.syncStatus.hasUnpushedEvents(remote) {
+			t.Error("Events should be pushed once the blob is")
+		}
+		if blobs, _ := remote.GetMatchingBlobs(ctx); len(blobs) != 1 || blobs[0] != checksum {
+			t.Errorf("Expected the blob on the remote, got %v", blobs)
+		}
+	})
+	t.Run("Websocket state is read concurrently with the web loop", func(t *testing.T) {
+		repo := NewDBListRepo(NewLocalFileWalFile(otherRootDir), NewFileWebTokenStore(otherRootDir))
+		repo.web.tokens.SetRefreshToken("token")
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 100; i++ {
+				repo.web.setActive(i%2 == 0)
+			}
+		}()
+		for i := 0; i < 100; i++ {
+			if status := repo.GetSyncStatus(); status.WebsocketState != WebsocketDisconnected {
+				t.Fatalf("Expected a disconnected websocket without a connection, but got %v", status.WebsocketState)
+			}
+		}
+		<-done
+	})
+}
+
+func TestServiceGetWalBytes(t *testing.T) {
+	ctx := context.Background()
+	t.Run("Web wals are only skipped if missing", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			switch req.URL.Path {
+			case "/missing":
+				w.WriteHeader(http.StatusNotFound)
+			case "/error":
+				w.WriteHeader(http.StatusInternalServerError)
+			default:
+				w.Write([]byte(base64.StdEncoding.EncodeToString([]byte("wal"))))
+			}
+		}))
+		defer srv.Close()
+
+		b := &bytes.Buffer{}
+		if err := getPresignedWal(ctx, b, srv.URL+"/wal", "wal"); err != nil || b.String() != "wal" {
+			t.Errorf("Expected the decoded wal, but got %q, %v", b.String(), err)
+		}
+		if err := getPresignedWal(ctx, &bytes.Buffer{}, srv.URL+"/missing", "missing"); err != nil {
+			t.Errorf("Missing wals should be skipped, but got %v", err)
+		}
+		if err := getPresignedWal(ctx, &bytes.Buffer{}, srv.URL+"/error", "error"); err == nil {
+			t.Errorf("Expected an error for a failed retrieval")
+		}
+	})
+	t.Run("Local wals are only skipped if missing", func(t *testing.T) {
+		dir := t.TempDir()
+		wf := NewLocalFileWalFile(dir)
+		if err := wf.GetWalBytes(ctx, &bytes.Buffer{}, "missing"); err != nil {
+			t.Errorf("Missing wals should be skipped, but got %v", err)
+		}
+		// A directory in place of the wal can't be read
+		if err := os.Mkdir(fmt.Sprintf(path.Join(dir, walFilePattern), "dir"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := wf.GetWalBytes(ctx, &bytes.Buffer{}, "dir"); err == nil {
+			t.Errorf("Expected an error for an unreadable wal")
+		}
+	})
+}
+
+// failingWalFile fails all operations with the given error, until it's cleared
+type failingWalFile struct {
+	*remoteWalFile
+	err   error
+	calls int
+}
+
+func (wf *failingWalFile) GetMatchingWals(ctx context.Context, pattern string) ([]string, error) {
+	wf.calls++
+	if wf.err != nil {
+		return nil, wf.err
+	}
+	return wf.remoteWalFile.GetMatchingWals(ctx, pattern)
+}
+
+func (wf *failingWalFile) Flush(ctx context.Context, b *bytes.Buffer, name string) error {
+	wf.calls++
+	if wf.err != nil {
+		return wf.err
+	}
+	return wf.remoteWalFile.Flush(ctx, b, name)
+}
+
+// failingBlobWalFile fails blob flushes with the given error, until it's cleared
+type failingBlobWalFile struct {
+	*remoteWalFile
+	err error
+}
+
+func (wf *failingBlobWalFile) FlushBlob(ctx context.Context, r io.Reader, checksum string) error {
+	if wf.err != nil {
+		return wf.err
+	}
+	return wf.remoteWalFile.FlushBlob(ctx, r, checksum)
+}
+
+func TestServiceRemoteErrors(t *testing.T) {
+	ctx := context.Background()
+	errFlaky := errors.New("flaky")
+
+	setup := func() (*DBListRepo, *failingWalFile, *[]error) {
+		repo := NewDBListRepo(NewLocalFileWalFile(otherRootDir), NewFileWebTokenStore(otherRootDir))
+		remote := &failingWalFile{
+			remoteWalFile: &remoteWalFile{NewLocalFileWalFile(t.TempDir())},
+			err:           errFlaky,
+		}
+		repo.AddWalFile(remote, true)
+		// Only collect errors for the remote, as the LocalWalFile root doesn't exist
+		notified := []error{}
+		repo.syncStatus.setErrorHandler(func(err error) {
+			if e := (&RemoteError{}); errors.As(err, &e) && e.WalFile == remote.GetUUID() {
+				notified = append(notified, err)
+			}
+		})
+		return repo, remote, &notified
+	}
+
+	t.Run("Errors are typed", func(t *testing.T) {
+		repo, remote, notified := setup()
+
+		complete, err := repo.pullAll(ctx, []WalFile{remote}, make(chan namedWal))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if complete {
+			t.Errorf("Pull should be incomplete")
+		}
+		if len(*notified) != 1 {
+			t.Fatalf("Expected 1 notified error but got %d", len(*notified))
+		}
+
+		var remoteErr *RemoteError
+		if !errors.As((*notified)[0], &remoteErr) {
+			t.Fatalf("Expected a RemoteError but got %v", (*notified)[0])
+		}
+		if remoteErr.Op != RemoteOpList || remoteErr.WalFile != remote.GetUUID() {
+			t.Errorf("Unexpected RemoteError %v", remoteErr)
+		}
+		if !errors.Is((*notified)[0], errFlaky) {
+			t.Errorf("RemoteError should wrap the underlying error")
+		}
+	})
+	t.Run("Failing remotes back off", func(t *testing.T) {
+		repo, remote, notified := setup()
+
+		repo.pullAll(ctx, []WalFile{remote}, make(chan namedWal))
+		repo.pullAll(ctx, []WalFile{remote}, make(chan namedWal))
+		if remote.calls != 1 {
+			t.Errorf("Remote should be skipped whilst backing off, but was called %d times", remote.calls)
+		}
+
+		e := repo.newEventLog(UpdateEvent)
+		e.ListItemKey = "1:1"
+		repo.flushPartialWals(ctx, []EventLog{e}, true)
+		if remote.calls != 1 {
+			t.Errorf("Remote should be skipped whilst backing off, but was called %d times", remote.calls)
+		}
+		if st := repo.GetSyncStatus().WalFiles[1]; st.UnpushedEvents != 1 || st.RetryAt.IsZero() {
+			t.Errorf("Unexpected status %v", st)
+		}
+
+		// Expire the backoff, and fail again
+		repo.syncStatus.walFiles[remote.GetUUID()].RetryAt = time.Now()
+		repo.pullAll(ctx, []WalFile{remote}, make(chan namedWal))
+		st := repo.syncStatus.walFiles[remote.GetUUID()]
+		if st.backoff != minRemoteBackoff*2 {
+			t.Errorf("Expected backoff %v but got %v", minRemoteBackoff*2, st.backoff)
+		}
+		if len(*notified) != 1 {
+			t.Errorf("Consecutive errors should only be notified once, got %d", len(*notified))
+		}
+
+		// Recover
+		remote.err = nil
+		st.RetryAt = time.Now()
+		if complete, _ := repo.pullAll(ctx, []WalFile{remote}, make(chan namedWal)); !complete {
+			t.Errorf("Pull should be complete")
+		}
+		if !repo.syncStatus.shouldAttempt(remote) || st.backoff != 0 {
+			t.Errorf("Backoff should be reset")
+		}
+		// The unpushed events are recovered via a checkpoint
+		repo.gather(ctx)
+		if st := repo.GetSyncStatus().WalFiles[1]; st.UnpushedEvents != 0 {
+			t.Errorf("Expected no unpushed events, but got %d", st.UnpushedEvents)
+		}
+	})
+}
+
+// namedWalFile allows multiple remoteWalFiles to be registered
+type namedWalFile struct {
+	*remoteWalFile
+	uuid string
+}
+
+func (wf *namedWalFile) GetUUID() string {
+	return wf.uuid
+}
+
+func TestServiceWalFilePolicy(t *testing.T) {
+	ctx := context.Background()
+
+	getRemoteEvents := func(t *testing.T, repo *DBListRepo, wf WalFile) []EventLog {
+		files, err := wf.GetMatchingWals(ctx, path.Join(wf.GetRoot(), "wal_*.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		el := []EventLog{}
+		for _, f := range files {
+			var b bytes.Buffer
+			if err := wf.GetWalBytes(ctx, &b, f); err != nil {
+				t.Fatal(err)
+			}
+			wal, err := repo.buildFromFile(&b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			el = append(el, wal...)
+		}
+		return el
+	}
+
+	setup := func() *DBListRepo {
+		repo := NewDBListRepo(NewLocalFileWalFile(otherRootDir), NewFileWebTokenStore(otherRootDir))
+		el := []EventLog{}
+		for _, item := range []struct{ key, line, target string }{
+			{"1:1", "personal", crdtRootKey},
+			{"1:2", "#work task", "1:1"},
+		} {
+			e := repo.newEventLog(UpdateEvent)
+			e.ListItemKey, e.Line = item.key, item.line
+			p := repo.newEventLog(PositionEvent)
+			p.ListItemKey, p.TargetListItemKey = item.key, item.target
+			el = append(el, e, p)
+		}
+		repo.Replay(el)
+		return repo
+	}
+
+	t.Run("Filtered remotes only receive matching items", func(t *testing.T) {
+		repo := setup()
+		remote := &remoteWalFile{NewLocalFileWalFile(t.TempDir())}
+		repo.AddWalFileWithPolicy(remote, WalFilePolicy{Match: []string{"#work"}})
+		repo.gather(ctx)
+
+		keys := make(map[string]struct{})
+		for _, e := range getRemoteEvents(t, repo, remote) {
+			keys[e.ListItemKey] = struct{}{}
+			if e.EventType == PositionEvent && e.TargetListItemKey != crdtRootKey {
+				t.Errorf("Position should be re-targeted to the root, but got %s", e.TargetListItemKey)
+			}
+		}
+		if _, exists := keys["1:1"]; exists {
+			t.Errorf("Unmatched item should not be pushed")
+		}
+		if _, exists := keys["1:2"]; !exists {
+			t.Errorf("Matched item should be pushed")
+		}
+	})
+	t.Run("Filtered checkpoints only remove our own wals", func(t *testing.T) {
+		repo := setup()
+		remote := &remoteWalFile{NewLocalFileWalFile(t.TempDir())}
+		repo.AddWalFileWithPolicy(remote, WalFilePolicy{Match: []string{"#work"}})
+
+		// Two other devices sync the remote in full, and our process has already pushed a delta wal to it
+		for i, line := range []string{"other personal", "third personal"} {
+			e := EventLog{UUID: uuid(i + 2), LamportTimestamp: repo.clock.next(), EventType: UpdateEvent, ListItemKey: fmt.Sprintf("%d:1", i+2), Line: line}
+			b, err := BuildByteWal([]EventLog{e})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := remote.Flush(ctx, b, fmt.Sprintf("device%d", i+2)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		repo.flushPartialWals(ctx, []EventLog{repo.crdt.addEventSet["1:2"]}, true)
+		if _, err := repo.pullAll(ctx, []WalFile{remote}, make(chan namedWal, 10)); err != nil {
+			t.Fatal(err)
+		}
+
+		repo.gather(ctx)
+
+		files, err := remote.GetMatchingWals(ctx, path.Join(remote.GetRoot(), "wal_*.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := make(map[string]struct{})
+		for _, f := range files {
+			names[f] = struct{}{}
+		}
+		for _, f := range []string{"device2", "device3"} {
+			if _, exists := names[f]; !exists {
+				t.Errorf("Wal %s from another device should not be removed", f)
+			}
+		}
+		// The delta is superseded by the checkpoint
+		if len(files) != 3 {
+			t.Errorf("Expected the checkpoint alongside the other devices' wals, but got %v", files)
+		}
+	})
+	t.Run("Matching updates carry the item position", func(t *testing.T) {
+		repo := setup()
+		remote := &remoteWalFile{NewLocalFileWalFile(t.TempDir())}
+		repo.AddWalFileWithPolicy(remote, WalFilePolicy{Match: []string{"personal"}})
+
+		e := repo.crdt.addEventSet["1:1"]
+		e.LamportTimestamp = repo.clock.next()
+		e.Line = "personal note"
+		repo.Replay([]EventLog{e})
+		repo.flushPartialWals(ctx, []EventLog{e}, true)
+
+		el := getRemoteEvents(t, repo, remote)
+		if len(el) != 2 || el[0].EventType != UpdateEvent || el[1].EventType != PositionEvent {
+			t.Fatalf("Expected an update and position event, but got %v", el)
+		}
+	})
+	t.Run("Sync direction", func(t *testing.T) {
+		repo := setup()
+		pushOnly := &namedWalFile{&remoteWalFile{NewLocalFileWalFile(t.TempDir())}, "backup"}
+		pullOnly := &failingWalFile{
+			remoteWalFile: &remoteWalFile{NewLocalFileWalFile(t.TempDir())},
+		}
+		repo.AddWalFileWithPolicy(pushOnly, WalFilePolicy{Direction: SyncPushOnly})
+		repo.AddWalFileWithPolicy(pullOnly, WalFilePolicy{Direction: SyncPullOnly})
+		if !repo.getWalFilePolicy(pullOnly).canPull() || repo.getWalFilePolicy(pushOnly).canPull() {
+			t.Errorf("Only the pull only remote should be pulled from")
+		}
+
+		repo.gather(ctx)
+		e := repo.newEventLog(UpdateEvent)
+		e.ListItemKey = "1:3"
+		repo.flushPartialWals(ctx, []EventLog{e}, true)
+
+		if pullOnly.calls != 0 {
+			t.Errorf("Pull only remote should not be pushed to, but was called %d times", pullOnly.calls)
+		}
+		if len(getRemoteEvents(t, repo, pushOnly)) == 0 {
+			t.Errorf("Push only remote should be pushed to")
+		}
+
+		status := repo.GetSyncStatus()
+		for _, st := range status.WalFiles {
+			if st.UUID == pushOnly.GetUUID() && st.Policy.Direction != SyncPushOnly {
+				t.Errorf("Expected push only policy in status, got %v", st.Policy)
+			}
+		}
+	})
+}
+
+func TestServiceWatchLocal(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	root := t.TempDir()
+	repo := NewDBListRepo(NewLocalFileWalFile(root), NewFileWebTokenStore(root))
+	replayChan := make(chan namedWal, 10)
+	// Stand in for the sync loop, which pulls on each trigger
+	trigger := func() {
+		repo.pull(ctx, []WalFile{repo.LocalWalFile}, replayChan)
+	}
+	if err := repo.watchLocalWalFile(ctx, trigger); err != nil {
+		t.Fatal(err)
+	}
+	if !repo.isWatchingLocal {
+		t.Fatal("Local walfile should be watched")
+	}
+
+	e := repo.newEventLog(UpdateEvent)
+	e.ListItemKey = "1:1"
+
+	// Our own wals are ignored
+	if err := repo.push(ctx, repo.LocalWalFile, []EventLog{e}, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	// Whereas those written by other processes are replayed immediately
+	b, err := BuildByteWal([]EventLog{e})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewLocalFileWalFile(root).Flush(ctx, b, "other"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case w := <-replayChan:
+		if w.name != "other" || len(w.wal) != 1 {
+			t.Errorf("Unexpected wal %s with %d events", w.name, len(w.wal))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wal should have been replayed")
+	}
+	select {
+	case w := <-replayChan:
+		t.Errorf("Unexpected replay of wal %s", w.name)
+	case <-time.After(localWatchDebounce * 4):
+	}
+}
+
+func TestServiceRootLock(t *testing.T) {
+	t.Run("Single leader", func(t *testing.T) {
+		root := t.TempDir()
+		leader, follower := newRootLock(root), newRootLock(root)
+		// Emulate another process
+		follower.pid = os.Getppid()
+
+		if !leader.tryAcquire() {
+			t.Fatal("Lock should be acquired")
+		}
+		if follower.tryAcquire() {
+			t.Fatal("Lock should be held by the leader")
+		}
+		leader.release()
+		if !follower.tryAcquire() {
+			t.Fatal("Follower should take over the released lock")
+		}
+	})
+	t.Run("Stale locks are taken over", func(t *testing.T) {
+		root := t.TempDir()
+		// PIDs are capped well below this on all supported platforms
+		if err := os.WriteFile(path.Join(root, rootLockFileName), []byte("999999999"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if !newRootLock(root).tryAcquire() {
+			t.Fatal("Stale lock should be taken over")
+		}
+	})
+	t.Run("Followers don't compact the local walfile", func(t *testing.T) {
+		ctx := context.Background()
+		root := t.TempDir()
+		// Another (running) process holds the lock
+		if err := os.WriteFile(path.Join(root, rootLockFileName), []byte(strconv.Itoa(os.Getppid())), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		repo := NewDBListRepo(NewLocalFileWalFile(root), NewFileWebTokenStore(root))
+		e := repo.newEventLog(UpdateEvent)
+		e.ListItemKey = "1:1"
+		repo.Replay([]EventLog{e})
+		repo.gather(ctx)
+
+		if wals, _ := repo.LocalWalFile.GetMatchingWals(ctx, path.Join(root, "wal_*.db")); len(wals) != 0 {
+			t.Errorf("Follower should not checkpoint the local walfile, found %v", wals)
+		}
+		if repo.GetSyncStatus().IsLocalLeader {
+			t.Errorf("Status should report a follower")
+		}
+
+		// The follower takes over once the leader has exited
+		os.Remove(path.Join(root, rootLockFileName))
+		repo.gather(ctx)
+		if wals, _ := repo.LocalWalFile.GetMatchingWals(ctx, path.Join(root, "wal_*.db")); len(wals) != 1 {
+			t.Errorf("Leader should checkpoint the local walfile, found %v", wals)
+		}
+	})
+}
+
+func TestServiceAtomicFlush(t *testing.T) {
+	ctx := context.Background()
+	t.Run("Flush leaves no temporary files", func(t *testing.T) {
+		root := t.TempDir()
+		wf := NewLocalFileWalFile(root)
+		if err := wf.Flush(ctx, bytes.NewBufferString("content"), "1"); err != nil {
+			t.Fatal(err)
+		}
+		b, err := os.ReadFile(path.Join(root, "wal_1.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != "content" {
+			t.Fatalf("Expected wal content %q, got %q", "content", string(b))
+		}
+		if fi, err := os.Stat(path.Join(root, "wal_1.db")); err != nil || (runtime.GOOS != "windows" && fi.Mode().Perm() != 0644) {
+			t.Fatalf("Expected wal mode 0644, got %v, %v", fi.Mode(), err)
+		}
+		tmp, _ := filepath.Glob(path.Join(root, tempFilePrefix+"*"+tempFileSuffix))
+		if len(tmp) != 0 {
+			t.Fatalf("Expected no temporary files, got %v", tmp)
+		}
+		names, err := wf.GetMatchingWals(ctx, path.Join(root, "wal_*.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(names) != 1 || names[0] != "1" {
+			t.Fatalf("Expected wals [1], got %v", names)
+		}
+	})
+	t.Run("Stale temporary files are removed", func(t *testing.T) {
+		root := t.TempDir()
+		wf := NewLocalFileWalFile(root)
+		stale := path.Join(root, ".wal_1.db.123.tmp")
+		fresh := path.Join(root, ".wal_2.db.456.tmp")
+		for _, p := range []string{stale, fresh} {
+			if err := os.WriteFile(p, []byte("partial"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		old := time.Now().Add(-2 * staleTempFileAge)
+		if err := os.Chtimes(stale, old, old); err != nil {
+			t.Fatal(err)
+		}
+
+		wf.removeStaleTempFiles(time.Now())
+
+		if _, err := os.Stat(stale); !os.IsNotExist(err) {
+			t.Fatal("Stale temporary file should be removed")
+		}
+		// Recent temporary files may be mid-write by another process
+		if _, err := os.Stat(fresh); err != nil {
+			t.Fatal("Recent temporary file should be kept")
+		}
+	})
+}
+
+func TestServiceBackup(t *testing.T) {
+	ctx := context.Background()
+	t.Run("Restore reverts to the snapshot", func(t *testing.T) {
+		root := t.TempDir()
+		repo := NewDBListRepo(NewLocalFileWalFile(root), NewFileWebTokenStore(root))
+		e := repo.newEventLog(UpdateEvent)
+		e.ListItemKey = "1:1"
+		if err := repo.push(ctx, repo.LocalWalFile, []EventLog{e}, nil, ""); err != nil {
+			t.Fatal(err)
+		}
+
+		name, err := NewDBListRepo(NewLocalFileWalFile(root), NewFileWebTokenStore(root)).Backup(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		e = repo.newEventLog(UpdateEvent)
+		e.ListItemKey = "2:1"
+		if err := repo.push(ctx, repo.LocalWalFile, []EventLog{e}, nil, ""); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := NewDBListRepo(NewLocalFileWalFile(root), NewFileWebTokenStore(root)).Restore(ctx, name); err != nil {
+			t.Fatal(err)
+		}
+
+		restored := NewDBListRepo(NewLocalFileWalFile(root), NewFileWebTokenStore(root))
+		if err := restored.LoadLocal(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if _, exists := restored.crdt.addEventSet["1:1"]; !exists {
+			t.Error("Item from the snapshot should be restored")
+		}
+		if _, exists := restored.crdt.addEventSet["2:1"]; exists {
+			t.Error("Item created after the snapshot should not be restored")
+		}
+		// The state prior to the restore is also snapshotted
+		if names, _ := ListBackups(root); len(names) != 2 {
+			t.Errorf("Expected 2 backups, got %v", names)
+		}
+	})
+	t.Run("Restore is refused whilst another process is running", func(t *testing.T) {
+		root := t.TempDir()
+		if err := os.WriteFile(path.Join(root, rootLockFileName), []byte(strconv.Itoa(os.Getppid())), 0644); err != nil {
+			t.Fatal(err)
+		}
+		repo := NewDBListRepo(NewLocalFileWalFile(root), NewFileWebTokenStore(root))
+		name, err := repo.Backup(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.Restore(ctx, name); err == nil {
+			t.Error("Restore should fail")
+		}
+	})
+	t.Run("Oldest backups are removed", func(t *testing.T) {
+		root := t.TempDir()
+		repo := NewDBListRepo(NewLocalFileWalFile(root), NewFileWebTokenStore(root))
+		repo.SetBackupRetention(2)
+		now := time.Now()
+		newest := ""
+		for i := 0; i < 3; i++ {
+			name, err := repo.backup(now.Add(time.Duration(i) * time.Second))
+			if err != nil {
+				t.Fatal(err)
+			}
+			newest = name
+		}
+		names, err := ListBackups(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(names) != 2 || names[0] != newest {
+			t.Errorf("Expected the 2 newest backups, got %v", names)
+		}
+	})
+}
+
+func TestServiceRecurrence(t *testing.T) {
+	t.Run("Hiding a recurring item generates the next occurrence", func(t *testing.T) {
+		repo, clearUp := setupRepo()
+		defer clearUp()
+
+		repo.Add("not recurring", nil, nil)
+		repo.Add("water plants every:day 2022-03-01", []byte("note"), nil)
+
+		matches, _, _ := repo.Match([][]rune{}, false, "", 0, 0)
+		repo.ToggleVisibility(repo.matchListItems[matches[0].key])
+
+		matches, _, _ = repo.Match([][]rune{}, false, "", 0, 0)
+		if len(matches) != 2 {
+			t.Fatalf("Expected 2 visible items, got %d", len(matches))
+		}
+		next := matches[0]
+		expectedLine := "water plants every:day " + time.Now().AddDate(0, 0, 1).Format(isoDateFormat)
+		if next.Line() != expectedLine {
+			t.Errorf("Expected line %q, got %q", expectedLine, next.Line())
+		}
+		if string(next.Note) != "note" {
+			t.Errorf("Expected the note to be copied, got %q", string(next.Note))
+		}
+
+		// Re-hiding the original doesn't generate another occurrence
+		all, _, _ := repo.Match([][]rune{}, true, "", 0, 0)
+		var original *ListItem
+		for _, m := range all {
+			if m.Key() != next.Key() && m.IsHidden {
+				original = repo.matchListItems[m.Key()]
+			}
+		}
+		if original == nil {
+			t.Fatal("Expected the original to be hidden")
+		}
+		repo.ToggleVisibility(original)
+		repo.Match([][]rune{}, true, "", 0, 0)
+		repo.ToggleVisibility(repo.matchListItems[original.Key()])
+		if matches, _, _ = repo.Match([][]rune{}, false, "", 0, 0); len(matches) != 2 {
+			t.Errorf("Expected 2 visible items, got %d", len(matches))
+		}
+
+		// Undo removes the generated item along with un-hiding the original
+		repo.Undo()
+		repo.Undo()
+		repo.Undo()
+		matches, _, _ = repo.Match([][]rune{}, false, "", 0, 0)
+		if len(matches) != 2 || matches[0].Line() != "water plants every:day 2022-03-01" {
+			t.Errorf("Expected the original item only, got %v", matches)
+		}
+
+		// Completing it again regenerates the occurrence
+		repo.ToggleVisibility(repo.matchListItems[matches[0].Key()])
+		matches, _, _ = repo.Match([][]rune{}, false, "", 0, 0)
+		if len(matches) != 2 || matches[0].Line() != expectedLine {
+			t.Errorf("Expected the next occurrence to be restored, got %v", matches)
+		}
+	})
+	t.Run("Concurrent completions generate a single occurrence", func(t *testing.T) {
+		repoA := NewDBListRepo(NewLocalFileWalFile(otherRootDir), NewFileWebTokenStore(otherRootDir))
+		repoB := NewDBListRepo(NewLocalFileWalFile(otherRootDir), NewFileWebTokenStore(otherRootDir))
+		repoB.uuid = repoA.uuid + 1
+		defer os.RemoveAll(otherRootDir)
+
+		e := repoA.newEventLog(UpdateEvent)
+		e.ListItemKey = e.key()
+		e.Line = "standup every:weekday"
+		pe := repoA.newEventLog(PositionEvent)
+		pe.ListItemKey = e.ListItemKey
+		repoA.Replay([]EventLog{e, pe})
+		repoB.Replay([]EventLog{e, pe})
+
+		now := time.Now()
+		eventsA, _ := repoA.getRecurrenceEvents(repoA.listItemCache[e.ListItemKey], now)
+		eventsB, _ := repoB.getRecurrenceEvents(repoB.listItemCache[e.ListItemKey], now)
+		if len(eventsA) == 0 || len(eventsB) == 0 {
+			t.Fatal("Expected recurrence events")
+		}
+		repoA.Replay(eventsB)
+		repoA.Replay(eventsA)
+
+		matches, _, _ := repoA.Match([][]rune{}, true, "", 0, 0)
+		if len(matches) != 2 {
+			t.Errorf("Expected 2 items, got %d", len(matches))
+		}
+	})
+	t.Run("Monthly occurrences don't drift", func(t *testing.T) {
+		repo := NewDBListRepo(NewLocalFileWalFile(otherRootDir), NewFileWebTokenStore(otherRootDir))
+		defer os.RemoveAll(otherRootDir)
+
+		for _, tt := range []struct {
+			line     string
+			expected []string
+		}{
+			{"pay rent every:month 2022-01-31", []string{"pay rent every:month on 31 2022-02-28", "pay rent every:month on 31 2022-03-31"}},
+			{"2022-01-31 pay rent every:month", []string{"2022-02-28 pay rent every:month on 31", "2022-03-31 pay rent every:month on 31"}},
+		} {
+			e := repo.newEventLog(UpdateEvent)
+			e.ListItemKey = e.key()
+			e.Line = tt.line
+			repo.Replay([]EventLog{e})
+			item := repo.listItemCache[e.ListItemKey]
+
+			// Each occurrence is completed before it's due
+			now := time.Date(2022, time.January, 30, 0, 0, 0, 0, time.Local)
+			for _, expected := range tt.expected {
+				events, _ := repo.getRecurrenceEvents(item, now)
+				if len(events) == 0 {
+					t.Fatalf("%q: expected recurrence events", item.Line())
+				}
+				repo.Replay(events)
+				item = repo.listItemCache[events[0].ListItemKey]
+				if item.Line() != expected {
+					t.Fatalf("Expected line %q, got %q", expected, item.Line())
+				}
+				now = now.AddDate(0, 1, 0)
+			}
+		}
+	})
+}
+
+func TestServiceAgenda(t *testing.T) {
+	t.Run("Buckets are relative to today", func(t *testing.T) {
+		// Wednesday
+		today := time.Date(2022, time.March, 2, 0, 0, 0, 0, time.Local)
+		tests := []struct {
+			date     time.Time
+			expected AgendaBucket
+		}{
+			{today.AddDate(0, 0, -1), AgendaOverdue},
+			{today, AgendaToday},
+			{today.AddDate(0, 0, 1), AgendaThisWeek},
+			{today.AddDate(0, 0, 4), AgendaThisWeek},
+			{today.AddDate(0, 0, 5), AgendaLater},
+		}
+		for _, tt := range tests {
+			if b := getAgendaBucket(tt.date, today); b != tt.expected {
+				t.Errorf("%s: expected %s, got %s", tt.date.Format(isoDateFormat), tt.expected, b)
+			}
+		}
+		// On Sundays, the week ends today
+		sunday := time.Date(2022, time.March, 6, 0, 0, 0, 0, time.Local)
+		if b := getAgendaBucket(sunday.AddDate(0, 0, 1), sunday); b != AgendaLater {
+			t.Errorf("Expected %s, got %s", AgendaLater, b)
+		}
+	})
+	t.Run("Dated items are grouped and sorted", func(t *testing.T) {
+		repo := NewDBListRepo(NewLocalFileWalFile(otherRootDir), NewFileWebTokenStore(otherRootDir))
+		defer os.RemoveAll(otherRootDir)
+
+		now := time.Now()
+		lines := []string{
+			"undated",
+			"later " + now.AddDate(0, 1, 0).Format(isoDateFormat),
+			"today " + now.Format(dateFormat),
+			"overdue " + now.AddDate(0, 0, -1).Format(isoDateFormat),
+			"more overdue " + now.AddDate(0, 0, -2).Format(isoDateFormat),
+		}
+		prevKey := ""
+		for _, l := range lines {
+			e := repo.newEventLog(UpdateEvent)
+			e.ListItemKey = e.key()
+			e.Line = l
+			pe := repo.newEventLog(PositionEvent)
+			pe.ListItemKey = e.ListItemKey
+			pe.TargetListItemKey = prevKey
+			repo.Replay([]EventLog{e, pe})
+			prevKey = e.ListItemKey
+		}
+		// Hidden items are excluded unless requested
+		e := repo.newEventLog(UpdateEvent)
+		e.ListItemKey = e.key()
+		e.Line = "completed " + now.Format(isoDateFormat)
+		e.IsHidden = true
+		pe := repo.newEventLog(PositionEvent)
+		pe.ListItemKey = e.ListItemKey
+		repo.Replay([]EventLog{e, pe})
+
+		groups := repo.GetAgenda(now, false)
+		if len(groups) != 3 {
+			t.Fatalf("Expected 3 groups, got %d", len(groups))
+		}
+		expected := []struct {
+			bucket AgendaBucket
+			lines  []string
+		}{
+			{AgendaOverdue, []string{lines[4], lines[3]}},
+			{AgendaToday, []string{lines[2]}},
+			{AgendaLater, []string{lines[1]}},
+		}
+		for i, g := range groups {
+			if g.Bucket != expected[i].bucket {
+				t.Errorf("Expected bucket %s, got %s", expected[i].bucket, g.Bucket)
+			}
+			if len(g.Items) != len(expected[i].lines) {
+				t.Errorf("Expected %d items in %s, got %d", len(expected[i].lines), g.Bucket, len(g.Items))
+				continue
+			}
+			for j, item := range g.Items {
+				if item.Line() != expected[i].lines[j] {
+					t.Errorf("Expected %q, got %q", expected[i].lines[j], item.Line())
+				}
+			}
+		}
+
+		if groups := repo.GetAgenda(now, true); len(groups[1].Items) != 2 {
+			t.Errorf("Expected hidden items to be included")
+		}
+	})
+}
+
+func TestServiceExportICS(t *testing.T) {
+	repo := NewDBListRepo(NewLocalFileWalFile(otherRootDir), NewFileWebTokenStore(otherRootDir))
+	defer os.RemoveAll(otherRootDir)
+
+	now := time.Date(2022, time.March, 2, 12, 0, 0, 0, time.Local)
+	add := func(line string, note string, isHidden bool) string {
+		e := repo.newEventLog(UpdateEvent)
+		e.ListItemKey = e.key()
+		e.Line = line
+		e.Note = []byte(note)
+		e.IsHidden = isHidden
+		pe := repo.newEventLog(PositionEvent)
+		pe.ListItemKey = e.ListItemKey
+		repo.Replay([]EventLog{e, pe})
+		return e.ListItemKey
+	}
+	key := add("pay rent, bills; etc 2022-03-01 "+strings.Repeat("x", 80), "line one\nline two", false)
+	hiddenKey := add("done 2022-03-03", "", true)
+	add("undated", "", false)
+
+	t.Run("Events", func(t *testing.T) {
+		var b bytes.Buffer
+		if err := repo.ExportICS(&b, ICSEvent, now); err != nil {
+			t.Fatal(err)
+		}
+		out := b.String()
+		for _, l := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+			if len(l) > icsMaxLineBytes {
+				t.Errorf("Line exceeds %d bytes: %q", icsMaxLineBytes, l)
+			}
+		}
+		// Unfold prior to checking content
+		unfolded := strings.ReplaceAll(out, "\r\n ", "")
+		for _, expected := range []string{
+			"BEGIN:VCALENDAR\r\n",
+			"UID:" + key + "\r\n",
+			"DTSTART;VALUE=DATE:20220301\r\n",
+			"DTEND;VALUE=DATE:20220302\r\n",
+			`SUMMARY:pay rent\, bills\; etc ` + strings.Repeat("x", 80) + "\r\n",
+			`DESCRIPTION:line one\nline two` + "\r\n",
+			"END:VCALENDAR\r\n",
+		} {
+			if !strings.Contains(unfolded, expected) {
+				t.Errorf("Expected output to contain %q, got:\n%s", expected, unfolded)
+			}
+		}
+		if strings.Contains(unfolded, hiddenKey) || strings.Contains(unfolded, "undated") {
+			t.Errorf("Expected archived and undated items to be omitted, got:\n%s", unfolded)
+		}
+	})
+	t.Run("Todos", func(t *testing.T) {
+		var b bytes.Buffer
+		if err := repo.ExportICS(&b, ICSTodo, now); err != nil {
+			t.Fatal(err)
+		}
+		unfolded := strings.ReplaceAll(b.String(), "\r\n ", "")
+		for _, expected := range []string{
+			"BEGIN:VTODO\r\nUID:" + key + "\r\n",
+			"DUE;VALUE=DATE:20220301\r\nSTATUS:NEEDS-ACTION\r\n",
+			"BEGIN:VTODO\r\nUID:" + hiddenKey + "\r\n",
+			"DUE;VALUE=DATE:20220303\r\nSTATUS:COMPLETED\r\n",
+		} {
+			if !strings.Contains(unfolded, expected) {
+				t.Errorf("Expected output to contain %q, got:\n%s", expected, unfolded)
+			}
+		}
+	})
+}
@@ -0,0 +1,247 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type WebsocketState int
+
+const (
+	WebsocketDisabled WebsocketState = iota // not logged in
+	WebsocketDisconnected
+	WebsocketConnected
+)
+
+func (s WebsocketState) String() string {
+	switch s {
+	case WebsocketConnected:
+		return "connected"
+	case WebsocketDisconnected:
+		return "disconnected"
+	}
+	return "disabled"
+}
+
+// WalFileStatus describes the sync health of a single WalFile
+type WalFileStatus struct {
+	UUID     string
+	Kind     string // e.g. "local", "web", "s3"
+	IsOwned  bool   // false for collaborator WalFiles, which are push only
+	Policy   WalFilePolicy
+	LastPull time.Time
+	LastPush time.Time
+	// UnpushedEvents is the number of events which failed to push since the last successful full checkpoint
+	UnpushedEvents int
+	LastError      error
+	LastErrorAt    time.Time
+	RetryAt        time.Time // the WalFile is skipped until this time, following consecutive errors
+	backoff        time.Duration
+}
+
+// fail records the error and extends the backoff, returning true if this is the first of consecutive failures
+func (st *WalFileStatus) fail(err error, now time.Time) bool {
+	isFirst := st.backoff == 0
+	st.LastError, st.LastErrorAt = err, now
+	st.backoff = nextRemoteBackoff(st.backoff)
+	st.RetryAt = now.Add(st.backoff)
+	return isFirst
+}
+
+func (st *WalFileStatus) succeed() {
+	st.backoff = 0
+	st.RetryAt = time.Time{}
+}
+
+// SyncStatus is a detailed breakdown of the sync state, see GetSyncState for a summary
+type SyncStatus struct {
+	Device         Device
+	State          SyncState
+	PendingEvents  int  // events held in memory, yet to be flushed to any WalFile
+	IsLocalLeader  bool // false if another process running against the same root is compacting the LocalWalFile
+	WebsocketState WebsocketState
+	LastWebError   error
+	WalFiles       []WalFileStatus
+}
+
+type syncStatusTracker struct {
+	sync.Mutex
+	walFiles      map[string]*WalFileStatus
+	lastWebError  error
+	pendingEvents int64
+	onError       func(error) // called on the first of consecutive failures for a WalFile
+}
+
+func newSyncStatusTracker() *syncStatusTracker {
+	return &syncStatusTracker{
+		walFiles: make(map[string]*WalFileStatus),
+	}
+}
+
+// walFileKind returns a short description of the WalFile type. Types defined outside of this package are
+// described by their package name (e.g. "s3").
+func walFileKind(wf WalFile) string {
+	switch wf.(type) {
+	case *LocalFileWalFile:
+		return "local"
+	case *WebWalFile:
+		return "web"
+	}
+	t := strings.TrimPrefix(fmt.Sprintf("%T", wf), "*")
+	if i := strings.Index(t, "."); i > 0 {
+		return t[:i]
+	}
+	return t
+}
+
+// update applies the function to the status of the WalFile, creating it if it doesn't exist. It's not an error for
+// the WalFile to have since been removed from the repo, as the status is only displayed for registered WalFiles.
+func (s *syncStatusTracker) update(wf WalFile, f func(*WalFileStatus)) {
+	s.Lock()
+	defer s.Unlock()
+	st, exists := s.walFiles[wf.GetUUID()]
+	if !exists {
+		st = &WalFileStatus{}
+		s.walFiles[wf.GetUUID()] = st
+	}
+	f(st)
+}
+
+func (s *syncStatusTracker) setErrorHandler(f func(error)) {
+	s.Lock()
+	defer s.Unlock()
+	s.onError = f
+}
+
+// recordError records a failed operation against the WalFile, and notifies the error handler if it was previously
+// healthy
+func (s *syncStatusTracker) recordError(wf WalFile, err error) {
+	var isFirst bool
+	s.update(wf, func(st *WalFileStatus) {
+		isFirst = st.fail(err, time.Now())
+	})
+	s.Lock()
+	onError := s.onError
+	s.Unlock()
+	if isFirst && onError != nil {
+		onError(err)
+	}
+}
+
+func (s *syncStatusTracker) recordPull(wf WalFile, err error) {
+	if err != nil {
+		s.recordError(wf, err)
+		return
+	}
+	s.update(wf, func(st *WalFileStatus) {
+		st.LastPull = time.Now()
+		st.succeed()
+	})
+}
+
+// recordPush records the outcome of a push of `n` events. Successful full checkpoints clear any previously
+// unpushed events.
+func (s *syncStatusTracker) recordPush(wf WalFile, n int, isCheckpoint bool, err error) {
+	if err != nil {
+		if !isCheckpoint {
+			s.update(wf, func(st *WalFileStatus) {
+				st.UnpushedEvents += n
+			})
+		}
+		s.recordError(wf, err)
+		return
+	}
+	s.update(wf, func(st *WalFileStatus) {
+		st.LastPush = time.Now()
+		st.succeed()
+		if isCheckpoint {
+			st.UnpushedEvents = 0
+		}
+	})
+}
+
+// recordSkippedPush records events which weren't pushed as the WalFile is backing off
+func (s *syncStatusTracker) recordSkippedPush(wf WalFile, n int) {
+	s.update(wf, func(st *WalFileStatus) {
+		st.UnpushedEvents += n
+	})
+}
+
+// shouldAttempt returns false whilst the WalFile is backing off after consecutive failures
+func (s *syncStatusTracker) shouldAttempt(wf WalFile) bool {
+	s.Lock()
+	defer s.Unlock()
+	st, exists := s.walFiles[wf.GetUUID()]
+	return !exists || !time.Now().Before(st.RetryAt)
+}
+
+func (s *syncStatusTracker) recordWebError(err error) {
+	s.Lock()
+	defer s.Unlock()
+	s.lastWebError = err
+}
+
+func (s *syncStatusTracker) addPendingEvents(n int) {
+	atomic.AddInt64(&s.pendingEvents, int64(n))
+}
+
+func (s *syncStatusTracker) hasUnpushedEvents(wf WalFile) bool {
+	s.Lock()
+	defer s.Unlock()
+	st, exists := s.walFiles[wf.GetUUID()]
+	return exists && st.UnpushedEvents > 0
+}
+
+// GetSyncStatus returns the sync status of each registered WalFile, ordered with the LocalWalFile first, followed
+// by owned WalFiles
+func (r *DBListRepo) GetSyncStatus() SyncStatus {
+	status := SyncStatus{
+		Device:        r.device,
+		State:         r.GetSyncState(),
+		PendingEvents: int(atomic.LoadInt64(&r.syncStatus.pendingEvents)),
+		IsLocalLeader: r.rootLock == nil || r.rootLock.isHeld(),
+	}
+
+	if r.web.tokens.RefreshToken() != "" {
+		status.WebsocketState = WebsocketDisconnected
+		if r.web.isConnected() {
+			status.WebsocketState = WebsocketConnected
+		}
+	}
+
+	r.allWalFileMut.RLock()
+	r.syncWalFileMut.RLock()
+	r.syncStatus.Lock()
+	for k, wf := range r.allWalFiles {
+		st := WalFileStatus{}
+		if s, exists := r.syncStatus.walFiles[k]; exists {
+			st = *s
+		}
+		st.UUID = k
+		st.Kind = walFileKind(wf)
+		_, st.IsOwned = r.syncWalFiles[k]
+		st.Policy = r.getWalFilePolicy(wf)
+		status.WalFiles = append(status.WalFiles, st)
+	}
+	status.LastWebError = r.syncStatus.lastWebError
+	r.syncStatus.Unlock()
+	r.syncWalFileMut.RUnlock()
+	r.allWalFileMut.RUnlock()
+
+	localUUID := r.LocalWalFile.GetUUID()
+	sort.Slice(status.WalFiles, func(i, j int) bool {
+		a, b := status.WalFiles[i], status.WalFiles[j]
+		if (a.UUID == localUUID) != (b.UUID == localUUID) {
+			return a.UUID == localUUID
+		}
+		if a.IsOwned != b.IsOwned {
+			return a.IsOwned
+		}
+		return a.UUID < b.UUID
+	})
+	return status
+}
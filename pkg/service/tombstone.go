@@ -0,0 +1,232 @@
+package service
+
+import (
+	"time"
+)
+
+// Tombstone garbage collection
+//
+// Deleted items are retained in the crdt (and therefore in every checkpoint) as tombstones, so that events for the
+// item which are generated concurrently with, but ordered before, the delete can't resurrect it. Once every device
+// has seen the delete, no such events can arrive, and the tombstone (along with all other state for the item) can be
+// pruned.
+//
+// Each device periodically emits an AckEvent after a complete pull from all of its sync WalFiles. The timestamp of
+// the AckEvent is the (wall clock) time at which the pull started, i.e. the device has seen all events pushed to the
+// remotes prior to that point. AckEvents are shared with collaborators, who push their own in return.
+//
+// A delete is pruned once it's older than the minimum ack across all known devices, AND older than the tombstone
+// horizon. Devices are known if they've generated any (HLC timestamped) item events, or emitted an ack, so a device
+// which has never acknowledged anything holds back garbage collection. Only the most recent ack per device is
+// retained: later processes on a device load its local wals, and therefore the events of any previous processes. The
+// current device has seen all the events it holds, so it's implicitly acknowledged. The horizon accounts for events
+// which were generated before an ack, but which had yet to reach the remotes (e.g. from devices which went offline
+// mid-flush).
+//
+// Pruned items leave no trace, so any events for them which are replayed again would resurrect them. Remote wals are
+// pulled again on every start, so garbage is only collected if all pulled WalFiles are compacted by full (unfiltered)
+// checkpoints, which replace any old wals.
+//
+// Tombstones with pure Lamport timestamps (from schemas prior to v8) can't be compared with the acks, so they're
+// treated as if they were made at the earliest HLC timestamp in the notebook, i.e. when it was migrated. Clients
+// prior to v8 don't emit acks, so any which are still running must be upgraded within the horizon of the migration.
+//
+// As such, a device which stops syncing will hold back garbage collection indefinitely. Only leaf nodes are pruned, as
+// other items may be positioned relative to the deleted item.
+
+const (
+	// DefaultTombstoneHorizon is used unless overridden by SetTombstoneHorizon
+	DefaultTombstoneHorizon = time.Hour * 24 * 30
+
+	ackInterval         = time.Hour
+	tombstoneGCInterval = time.Hour
+)
+
+// SetTombstoneHorizon sets the minimum age of a delete before it can be garbage collected. A zero value disables
+// garbage collection.
+func (r *DBListRepo) SetTombstoneHorizon(d time.Duration) {
+	r.tombstoneHorizon = d
+}
+
+func (crdt *crdtTree) ack(e EventLog) {
+	crdt.observe(e)
+	d := eventDevice(e)
+	if ce, exists := crdt.ackEventSet[d]; !exists || ce.LamportTimestamp < e.LamportTimestamp {
+		crdt.ackEventSet[d] = e
+	}
+}
+
+// eventDevice returns the ID of the device the event was generated on, falling back to the origin for events which
+// don't have one
+func eventDevice(e EventLog) uuid {
+	if e.DeviceID != 0 {
+		return e.DeviceID
+	}
+	return e.UUID
+}
+
+// observe records the device of an item event, along with the earliest HLC timestamp. Events with pure Lamport
+// timestamps are ignored, as processes prior to schema v8 don't emit acks. Events without a device (e.g. those built
+// from plain text imports) are ignored too, as nothing would acknowledge them.
+func (crdt *crdtTree) observe(e EventLog) {
+	if e.LamportTimestamp < hlcEpoch {
+		return
+	}
+	if crdt.firstTimestamp == 0 || e.LamportTimestamp < crdt.firstTimestamp {
+		crdt.firstTimestamp = e.LamportTimestamp
+	}
+	if e.EventType != AckEvent && e.DeviceID != 0 {
+		crdt.devices[e.DeviceID] = struct{}{}
+	}
+}
+
+// minAck returns the minimum acked timestamp across all known devices, or 0 if any have yet to be acknowledged. The
+// given device is acknowledged at `now`.
+func (crdt *crdtTree) minAck(self uuid, now int64) int64 {
+	acks := map[uuid]int64{self: now}
+	for d, e := range crdt.ackEventSet {
+		if d != self {
+			acks[d] = e.LamportTimestamp
+		}
+	}
+	for d := range crdt.devices {
+		if _, exists := acks[d]; !exists {
+			return 0
+		}
+	}
+	var min int64
+	for _, ts := range acks {
+		if ts <= 0 {
+			return 0
+		}
+		if min == 0 || ts < min {
+			min = ts
+		}
+	}
+	return min
+}
+
+// isPrunable returns whether all state for the key predates the cutoff, and the item is a deleted leaf
+func (crdt *crdtTree) isPrunable(key string, cutoff int64) bool {
+	if crdt.itemIsLive(key) {
+		return false
+	}
+	if e, exists := crdt.addEventSet[key]; exists && e.LamportTimestamp >= cutoff {
+		return false
+	}
+	if e, exists := crdt.positionEventSet[key]; exists && e.LamportTimestamp >= cutoff {
+		return false
+	}
+	if n, exists := crdt.cache[key]; exists && n.children.firstChild != nil {
+		return false
+	}
+	return true
+}
+
+func (crdt *crdtTree) prune(key string) {
+	delete(crdt.addEventSet, key)
+	delete(crdt.deleteEventSet, key)
+	delete(crdt.positionEventSet, key)
+	if n, exists := crdt.cache[key]; exists {
+		n.parent.children.removeChild(n)
+		delete(crdt.cache, key)
+	}
+}
+
+// collectGarbage prunes deletes which precede the cutoff, and returns the pruned keys
+func (crdt *crdtTree) collectGarbage(cutoff int64) []string {
+	pruned := []string{}
+	// Pruning a leaf can render its parent a leaf, so repeat until there's nothing left to prune
+	for {
+		n := len(pruned)
+		for key, e := range crdt.deleteEventSet {
+			ts := e.LamportTimestamp
+			if ts < hlcEpoch {
+				// See the migration horizon above
+				if crdt.firstTimestamp == 0 {
+					continue
+				}
+				ts = crdt.firstTimestamp
+			}
+			if ts < cutoff && crdt.isPrunable(key, cutoff) {
+				crdt.prune(key)
+				pruned = append(pruned, key)
+			}
+		}
+		if len(pruned) == n {
+			return pruned
+		}
+	}
+}
+
+// collectGarbage must be called from the same thread of control as Replay
+func (r *DBListRepo) collectGarbage(now time.Time) []string {
+	if r.tombstoneHorizon <= 0 || !r.pulledWalFilesAreCompacted() {
+		return nil
+	}
+	r.crdt.Lock()
+	defer r.crdt.Unlock()
+
+	cutoff := now.Add(-r.tombstoneHorizon).UnixNano()
+	if minAck := r.crdt.minAck(r.device.ID, now.UnixNano()); minAck < cutoff {
+		cutoff = minAck
+	}
+	pruned := r.crdt.collectGarbage(cutoff)
+	for _, key := range pruned {
+		delete(r.listItemCache, key)
+	}
+	return pruned
+}
+
+// pulledWalFilesAreCompacted returns whether all of the WalFiles we pull from receive full checkpoints, which remove
+// all prior wals
+func (r *DBListRepo) pulledWalFilesAreCompacted() bool {
+	r.syncWalFileMut.RLock()
+	defer r.syncWalFileMut.RUnlock()
+	for _, wf := range r.syncWalFiles {
+		if p := r.getWalFilePolicy(wf); p.canPull() && (!p.canPush() || p.isFiltered()) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasRemotes returns whether we sync with any WalFiles other than the LocalWalFile. Acks are only required by other
+// devices, so they aren't emitted otherwise.
+func (r *DBListRepo) hasRemotes() bool {
+	r.syncWalFileMut.RLock()
+	defer r.syncWalFileMut.RUnlock()
+	for _, wf := range r.syncWalFiles {
+		if wf != r.LocalWalFile {
+			return true
+		}
+	}
+	return false
+}
+
+// emitAck applies the ack locally (via the replay loop) and pushes it to the remotes
+func (r *DBListRepo) emitAck(pullStart time.Time, replayChan chan namedWal) {
+	r.lastAck = pullStart
+	r.sendAck(r.newAckEvent(pullStart.UnixNano()), replayChan)
+}
+
+func (r *DBListRepo) sendAck(ack EventLog, replayChan chan namedWal) {
+	replayChan <- namedWal{
+		wal: []EventLog{ack},
+	}
+	go func() {
+		r.eventsChan <- ack
+	}()
+}
+
+// newAckEvent acknowledges receipt of all events pushed to the remotes prior to the given (wall clock) timestamp
+func (r *DBListRepo) newAckEvent(ts int64) EventLog {
+	return EventLog{
+		UUID:             r.uuid,
+		LamportTimestamp: ts,
+		EventType:        AckEvent,
+		// The device name is shared via acks, see `DeviceName`
+		Line:     r.device.Name,
+		DeviceID: r.device.ID,
+	}
+}
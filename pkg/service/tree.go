@@ -3,6 +3,7 @@ package service
 import (
 	"strconv"
 	"strings"
+	"sync"
 )
 
 const (
@@ -10,9 +11,15 @@ const (
 	crdtOrphanKey = "_orphan"
 )
 
+// crdtTree is only mutated on the replay loop (see `Start`), which is also where the client reads from it. The lock
+// guards against concurrent reads from the sync goroutines, which build checkpoints and filtered wals from it.
 type crdtTree struct {
+	sync.RWMutex
 	cache                                         map[string]*node
 	addEventSet, deleteEventSet, positionEventSet map[string]EventLog
+	ackEventSet                                   map[uuid]EventLog // the most recent AckEvent per device
+	devices                                       map[uuid]struct{} // the devices of all processed item events
+	firstTimestamp                                int64             // the earliest processed HLC timestamp
 }
 
 type node struct {
@@ -125,6 +132,8 @@ func newTree() *crdtTree {
 		addEventSet:      make(map[string]EventLog),
 		deleteEventSet:   make(map[string]EventLog),
 		positionEventSet: make(map[string]EventLog),
+		ackEventSet:      make(map[uuid]EventLog),
+		devices:          make(map[uuid]struct{}),
 	}
 }
 
@@ -172,6 +181,11 @@ func (crdt *crdtTree) generateEvents() []EventLog {
 		events = append(events, e)
 	}
 
+	// Add AckEvents
+	for _, e := range crdt.ackEventSet {
+		events = append(events, e)
+	}
+
 	return events
 }
 
@@ -190,7 +204,7 @@ func (crdt *crdtTree) add(e EventLog) {
 		var ts int64
 		var originUUID uuid
 		if len(r) > 0 {
-			i, _ := strconv.ParseInt(r[0], 10, 64)
+			i, _ := strconv.ParseUint(r[0], 10, 64)
 			originUUID = uuid(i)
 			if len(r) > 1 {
 				ts, _ = strconv.ParseInt(r[1], 10, 64)
@@ -0,0 +1,263 @@
+package service
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// WAL schema v8 format
+//
+// v8 wals are designed to be streamable (events can be decoded one at a time, without holding the full wal in
+// memory), appendable, partially readable and language neutral. A wal file is laid out as follows:
+//
+//	+---------------------------------+
+//	| schema ID (uint16 LE) == 8      |  2 bytes, uncompressed
+//	+---------------------------------+
+//	| gzip member(s)                  |
+//	|  +---------------------------+  |
+//	|  | length (uvarint)          |  |  one record per event
+//	|  | event (CBOR, `length` B)  |  |
+//	|  +---------------------------+  |
+//	|  | ...                       |  |
+//	+---------------------------------+
+//
+// - The gzipped payload may consist of multiple concatenated gzip members (RFC 1952), so events can be appended to an
+//   existing wal by writing a new gzip member to the end of the file.
+// - Each record is an unsigned varint (as per protobuf/`encoding/binary`) byte length, followed by a single CBOR
+//   (RFC 8949) encoded event. Readers can skip records they're unable to decode.
+// - If a wal is truncated, all complete records prior to the truncation are still readable.
+// - Events are CBOR maps with unsigned integer keys (below). Keys with zero values may be omitted, and unknown keys
+//   must be ignored, so fields can be added without a schema bump.
+//
+//	Event                           Friends                  Attachment
+//	  1: uuid            uint       1: isProcessed  bool      1: name      text
+//	  2: timestamp (HLC) int        2: offset       int       2: checksum  text
+//	  3: eventType       uint       3: emails       [text]    3: size      int
+//	  4: listItemKey     text
+//	  5: targetKey       text
+//	  6: line            text
+//	  7: note            bytes
+//	  8: isHidden        bool
+//	  9: friends         Friends
+//	 10: attachments     [Attachment]
+//	 11: authorEmail     text
+//	 12: deviceID        uint
+//
+// See `hlcEpoch` for the timestamp semantics, and `EventType` for the event type enum.
+
+const (
+	// maxWalRecordSize protects against allocating huge buffers when reading corrupt wals
+	maxWalRecordSize = 1 << 26
+)
+
+var (
+	errWalRecordTooLarge = errors.New("wal record exceeds maximum size")
+	errWalRecordInvalid  = errors.New("unable to decode wal record")
+)
+
+type walRecordFriends struct {
+	IsProcessed bool     `cbor:"1,keyasint,omitempty"`
+	Offset      int      `cbor:"2,keyasint,omitempty"`
+	Emails      []string `cbor:"3,keyasint,omitempty"`
+}
+
+type walRecordAttachment struct {
+	Name     string `cbor:"1,keyasint,omitempty"`
+	Checksum string `cbor:"2,keyasint,omitempty"`
+	Size     int64  `cbor:"3,keyasint,omitempty"`
+}
+
+type walRecord struct {
+	UUID              uint64                `cbor:"1,keyasint,omitempty"`
+	Timestamp         int64                 `cbor:"2,keyasint,omitempty"`
+	EventType         uint16                `cbor:"3,keyasint,omitempty"`
+	ListItemKey       string                `cbor:"4,keyasint,omitempty"`
+	TargetListItemKey string                `cbor:"5,keyasint,omitempty"`
+	Line              string                `cbor:"6,keyasint,omitempty"`
+	Note              []byte                `cbor:"7,keyasint,omitempty"`
+	IsHidden          bool                  `cbor:"8,keyasint,omitempty"`
+	Friends           *walRecordFriends     `cbor:"9,keyasint,omitempty"`
+	Attachments       []walRecordAttachment `cbor:"10,keyasint,omitempty"`
+	AuthorEmail       string                `cbor:"11,keyasint,omitempty"`
+	DeviceID          uint64                `cbor:"12,keyasint,omitempty"`
+}
+
+func newWalRecord(e EventLog) walRecord {
+	rec := walRecord{
+		UUID:              uint64(e.UUID),
+		Timestamp:         e.LamportTimestamp,
+		EventType:         uint16(e.EventType),
+		ListItemKey:       e.ListItemKey,
+		TargetListItemKey: e.TargetListItemKey,
+		Line:              e.Line,
+		Note:              e.Note,
+		IsHidden:          e.IsHidden,
+		AuthorEmail:       e.AuthorEmail,
+		DeviceID:          uint64(e.DeviceID),
+	}
+	if f := e.Friends; f.IsProcessed || f.Offset != 0 || len(f.Emails) > 0 {
+		rec.Friends = &walRecordFriends{
+			IsProcessed: f.IsProcessed,
+			Offset:      f.Offset,
+			Emails:      f.Emails,
+		}
+	}
+	for _, a := range e.Attachments {
+		rec.Attachments = append(rec.Attachments, walRecordAttachment{
+			Name:     a.Name,
+			Checksum: a.Checksum,
+			Size:     a.Size,
+		})
+	}
+	return rec
+}
+
+func (rec walRecord) eventLog() EventLog {
+	e := EventLog{
+		UUID:              uuid(rec.UUID),
+		LamportTimestamp:  rec.Timestamp,
+		EventType:         EventType(rec.EventType),
+		ListItemKey:       rec.ListItemKey,
+		TargetListItemKey: rec.TargetListItemKey,
+		Line:              rec.Line,
+		Note:              rec.Note,
+		IsHidden:          rec.IsHidden,
+		AuthorEmail:       rec.AuthorEmail,
+		DeviceID:          uuid(rec.DeviceID),
+	}
+	if f := rec.Friends; f != nil {
+		e.Friends = LineFriends{
+			IsProcessed: f.IsProcessed,
+			Offset:      f.Offset,
+			Emails:      f.Emails,
+		}
+	}
+	for _, a := range rec.Attachments {
+		e.Attachments = append(e.Attachments, Attachment{
+			Name:     a.Name,
+			Checksum: a.Checksum,
+			Size:     a.Size,
+		})
+	}
+	return e
+}
+
+// WalWriter streams events into the gzipped record section of a wal. The schema ID is written separately (see
+// `BuildByteWal`), which allows a WalWriter to append a new gzip member to an existing wal.
+type WalWriter struct {
+	zw  *gzip.Writer
+	buf []byte
+}
+
+func NewWalWriter(w io.Writer) *WalWriter {
+	return &WalWriter{
+		zw:  gzip.NewWriter(w),
+		buf: make([]byte, binary.MaxVarintLen64),
+	}
+}
+
+// Write encodes a single event as a length-prefixed record
+func (ww *WalWriter) Write(e EventLog) error {
+	b, err := cbor.Marshal(newWalRecord(e))
+	if err != nil {
+		return err
+	}
+	n := binary.PutUvarint(ww.buf, uint64(len(b)))
+	if _, err := ww.zw.Write(ww.buf[:n]); err != nil {
+		return err
+	}
+	_, err = ww.zw.Write(b)
+	return err
+}
+
+// Close flushes any buffered records and terminates the gzip member. It does not close the underlying writer.
+func (ww *WalWriter) Close() error {
+	return ww.zw.Close()
+}
+
+// WalDecoder streams events from the gzipped record section of a v8 wal (e.g. after the schema ID has been read)
+type WalDecoder struct {
+	zr *gzip.Reader
+	r  *bufio.Reader
+}
+
+func NewWalDecoder(r io.Reader) (*WalDecoder, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &WalDecoder{
+		zr: zr,
+		r:  bufio.NewReader(zr),
+	}, nil
+}
+
+// Next returns the next event in the wal. It returns io.EOF once all events have been read, or
+// io.ErrUnexpectedEOF if the wal is truncated mid-record. If a single record can't be decoded, errWalRecordInvalid
+// is returned, and the decoder can continue to the next record.
+func (d *WalDecoder) Next() (EventLog, error) {
+	l, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		return EventLog{}, err
+	}
+	if l > maxWalRecordSize {
+		return EventLog{}, errWalRecordTooLarge
+	}
+	b := make([]byte, l)
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return EventLog{}, err
+	}
+	rec := walRecord{}
+	if err := cbor.Unmarshal(b, &rec); err != nil {
+		return EventLog{}, errWalRecordInvalid
+	}
+	return rec.eventLog(), nil
+}
+
+func (d *WalDecoder) Close() error {
+	return d.zr.Close()
+}
+
+// decodeWal reads all events from a v8 wal record section. If the wal is truncated, the events prior to the
+// truncation are returned alongside the error.
+func decodeWal(r io.Reader) ([]EventLog, error) {
+	el := []EventLog{}
+	dec, err := NewWalDecoder(r)
+	if err != nil {
+		return el, err
+	}
+	defer dec.Close()
+	for {
+		e, err := dec.Next()
+		if err == io.EOF {
+			return el, nil
+		} else if err == errWalRecordInvalid {
+			continue
+		} else if err != nil {
+			return el, err
+		}
+		el = append(el, e)
+	}
+}
+
+// ConvertWal reads a wal of any schema version, and writes it out in the latest schema
+func (r *DBListRepo) ConvertWal(raw io.Reader, w io.Writer) error {
+	el, err := r.buildFromFile(raw)
+	if err != nil {
+		return err
+	}
+	b, err := BuildByteWal(el)
+	if err != nil {
+		return err
+	}
+	_, err = b.WriteTo(w)
+	return err
+}
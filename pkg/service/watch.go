@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// localWatchDebounce groups the events from a single write (and bursts of files dropped in by sync tools) into a
+// single pull
+const localWatchDebounce = time.Millisecond * 50
+
+func isWalFileName(name string) bool {
+	matched, _ := path.Match("wal_*.db", path.Base(name))
+	return matched
+}
+
+// watchLocalWalFile calls trigger as soon as wals are written to the root directory by other processes (e.g. another
+// fzn instance, or a sync tool such as Syncthing), so the LocalWalFile is pulled immediately, rather than on the next
+// periodic pull. The pull itself is left to the sync loop, so it never runs concurrently with other pulls. The
+// periodic pull remains as a fallback, so errors here are non-fatal. If the watch is established, local changes are also
+// flushed to the LocalWalFile on each publish, rather than on the (slower) push interval, so other instances on the
+// same machine receive them promptly.
+func (r *DBListRepo) watchLocalWalFile(ctx context.Context, trigger func()) error {
+	wf, ok := r.LocalWalFile.(*LocalFileWalFile)
+	if !ok {
+		return nil
+	}
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := w.Add(wf.GetRoot()); err != nil {
+		w.Close()
+		return err
+	}
+	r.isWatchingLocal = true
+
+	go func() {
+		defer w.Close()
+		debounce := time.NewTimer(localWatchDebounce)
+		debounce.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				// Renames are reported as a Create for the new name
+				if e.Op&(fsnotify.Create|fsnotify.Write) == 0 || !isWalFileName(e.Name) {
+					continue
+				}
+				debounce.Reset(localWatchDebounce)
+			case _, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+			case <-debounce.C:
+				// Our own wals are marked as processed prior to flushing (see `push`), so are skipped by the pull
+				trigger()
+			}
+		}
+	}()
+	return nil
+}
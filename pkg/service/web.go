@@ -9,7 +9,6 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
 	"path"
@@ -51,18 +50,20 @@ func (w *Web) establishWebSocketConnection() error {
 		return websocket.Dial(ctx, u.String(), &websocket.DialOptions{})
 	}
 
+	var conn *websocket.Conn
 	var resp *http.Response
 	var err error
 	idToken := w.tokens.IDToken()
 	if idToken != "" {
-		w.wsConn, resp, err = dialFunc(w.tokens.IDToken())
+		conn, resp, err = dialFunc(w.tokens.IDToken())
+		w.setConn(conn)
 	}
 	// TODO re-authentication explicitly handled here as wss handshake only occurs once (doesn't require
 	// retries) - can probably dedup at least a little
 	if idToken == "" || err != nil || resp == nil || resp.StatusCode != http.StatusSwitchingProtocols {
 		defer w.tokens.Flush()
 		w.tokens.SetIDToken("")
-		w.wsConn = nil
+		w.setConn(nil)
 		body := map[string]string{
 			"refreshToken": w.tokens.RefreshToken(),
 		}
@@ -74,7 +75,8 @@ func (w *Web) establishWebSocketConnection() error {
 			}
 			return err
 		}
-		w.wsConn, resp, err = dialFunc(w.tokens.IDToken())
+		conn, resp, err = dialFunc(w.tokens.IDToken())
+		w.setConn(conn)
 		// need to return within this nested block otherwise the outside err still holds
 		// data from previous calls
 		return err
@@ -149,7 +151,7 @@ func (w *Web) pushWebsocket(m websocketMessage) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
 	defer cancel()
 
-	return w.wsConn.Write(ctx, websocket.MessageText, []byte(marshalData))
+	return w.conn().Write(ctx, websocket.MessageText, []byte(marshalData))
 	//if err != nil {
 	//    // Re-establish websocket connection on error
 	//    // TODO currently attempting to re-establish connection on ANY error - do better at
@@ -168,7 +170,7 @@ func (w *Web) pushWebsocket(m websocketMessage) error {
 
 func (r *DBListRepo) consumeWebsocket(ctx context.Context) ([]EventLog, error) {
 	var el []EventLog
-	_, body, err := r.web.wsConn.Read(ctx)
+	_, body, err := r.web.conn().Read(ctx)
 	if err != nil {
 		return el, err
 	}
@@ -252,7 +254,7 @@ func (wf *WebWalFile) GetMatchingWals(ctx context.Context, pattern string) ([]st
 
 	req, err := http.NewRequest("GET", u.String(), nil)
 	if err != nil {
-		log.Fatalf("Error creating wal list request: %v", err)
+		return nil, err
 	}
 
 	req = req.WithContext(ctx)
@@ -263,13 +265,12 @@ func (wf *WebWalFile) GetMatchingWals(ctx context.Context, pattern string) ([]st
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		//log.Printf("Error retrieving wal list: %v", err)
-		return nil, nil
+		return nil, fmt.Errorf("retrieving wal list: %s", resp.Status)
 	}
 
 	byteUUIDs, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return nil, nil
+		return nil, err
 	}
 
 	var uuids []string
@@ -288,7 +289,16 @@ func (wf *WebWalFile) GetWalBytes(ctx context.Context, w io.Writer, fileName str
 		return err
 	}
 
+	return getPresignedWal(ctx, w, presignedURL, fileName)
+}
+
+// getPresignedWal writes the decoded wal at the presigned URL to w. Missing wals have been merged and removed by
+// another process, so are skipped. All other failures are returned, so the wal isn't treated as processed.
+func getPresignedWal(ctx context.Context, w io.Writer, presignedURL, fileName string) error {
 	req, err := http.NewRequest("GET", presignedURL, nil)
+	if err != nil {
+		return err
+	}
 	req = req.WithContext(ctx)
 
 	resp, err := http.DefaultClient.Do(req)
@@ -296,12 +306,17 @@ func (wf *WebWalFile) GetWalBytes(ctx context.Context, w io.Writer, fileName str
 		return err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("retrieving wal %s: %s", fileName, resp.Status)
+	}
 
 	dec := base64.NewDecoder(base64.StdEncoding, resp.Body)
 
-	io.Copy(w, dec)
-
-	return nil
+	_, err = io.Copy(w, dec)
+	return err
 }
 
 func (wf *WebWalFile) RemoveWals(ctx context.Context, fileNames []string) error {
@@ -0,0 +1,284 @@
+package sftp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	walFilePattern = "wal_%v.db" // TODO dedup, as is in service package
+
+	// Wals are written to a temporary file, and renamed once complete, so partial wals are never pulled. The prefix
+	// ensures they aren't matched by GetMatchingWals.
+	tempFilePrefix = "."
+	tempFileSuffix = ".tmp"
+
+	defaultPort = "22"
+	dialTimeout = time.Second * 10
+)
+
+// SFTPRemote configures a directory on a server accessible via SSH. Authentication is key based, via the key file
+// and/or a running ssh-agent. The host key must be present in the known hosts file.
+type SFTPRemote struct {
+	Host           string // host[:port]
+	User           string
+	Path           string // the remote directory in which the wals are stored
+	KeyFile        string `yaml:"keyFile"`        // defaults to ~/.ssh/id_ed25519, then ~/.ssh/id_rsa
+	KnownHostsFile string `yaml:"knownHostsFile"` // defaults to ~/.ssh/known_hosts
+	Sync           string
+	Match          []string
+}
+
+type sftpWalFile struct {
+	uuid string
+	dir  string
+
+	// The connection is established lazily, and re-established on the next operation following an error. Closing
+	// the client doesn't close the connection it runs over, so both are held.
+	mut     sync.Mutex
+	client  *sftp.Client
+	conn    io.Closer
+	connect func() (*sftp.Client, io.Closer, error)
+}
+
+func NewSFTPWalFile(cfg SFTPRemote) (*sftpWalFile, error) {
+	if cfg.Host == "" || cfg.User == "" || cfg.Path == "" {
+		return nil, errors.New("host, user and path are required")
+	}
+	addr := cfg.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, defaultPort)
+	}
+
+	sshCfg, err := getSSHConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	wf := newSFTPWalFile(fmt.Sprintf("%s@%s", cfg.User, addr), cfg.Path, func() (*sftp.Client, io.Closer, error) {
+		conn, err := dialSSH(addr, sshCfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		c, err := sftp.NewClient(conn)
+		if err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+		return c, conn, nil
+	})
+	return wf, nil
+}
+
+func newSFTPWalFile(host string, dir string, connect func() (*sftp.Client, io.Closer, error)) *sftpWalFile {
+	return &sftpWalFile{
+		uuid:    host + ":" + dir,
+		dir:     dir,
+		connect: connect,
+	}
+}
+
+// expandHome expands a leading "~" in the path to the home directory
+func expandHome(p string, home string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		return filepath.Join(home, p[1:])
+	}
+	return p
+}
+
+func getSSHConfig(cfg SFTPRemote) (*ssh.ClientConfig, error) {
+	home, _ := os.UserHomeDir()
+	cfg.KeyFile = expandHome(cfg.KeyFile, home)
+
+	knownHostsFile := expandHome(cfg.KnownHostsFile, home)
+	if knownHostsFile == "" {
+		knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeyCallback, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// The ssh-agent, if any, is added on each dial, see `dialSSH`
+	auth := []ssh.AuthMethod{}
+
+	keyFiles := []string{cfg.KeyFile}
+	if cfg.KeyFile == "" {
+		keyFiles = []string{filepath.Join(home, ".ssh", "id_ed25519"), filepath.Join(home, ".ssh", "id_rsa")}
+	}
+	for _, f := range keyFiles {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			// Only an explicitly configured key is required to exist
+			if cfg.KeyFile != "" {
+				return nil, err
+			}
+			continue
+		}
+		signer, err := ssh.ParsePrivateKey(b)
+		if err != nil {
+			return nil, fmt.Errorf("parsing key %s: %w", f, err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+		break
+	}
+	if len(auth) == 0 && os.Getenv("SSH_AUTH_SOCK") == "" {
+		return nil, errors.New("no ssh key file or agent available")
+	}
+
+	return &ssh.ClientConfig{
+		User:            cfg.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         dialTimeout,
+	}, nil
+}
+
+// dialSSH connects to the server, authenticating via the ssh-agent (if running) ahead of the configured keys. The
+// agent is only required for the handshake, so its connection is closed once connected.
+func dialSSH(addr string, cfg *ssh.ClientConfig) (*ssh.Client, error) {
+	c := *cfg
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			defer conn.Close()
+			c.Auth = append([]ssh.AuthMethod{ssh.PublicKeysCallback(agent.NewClient(conn).Signers)}, cfg.Auth...)
+		}
+	}
+	return ssh.Dial("tcp", addr, &c)
+}
+
+// do runs the operation with a connected client. Connections are dropped on error, as the error may be due to a
+// broken connection, and they're cheap to re-establish relative to the sync interval.
+func (wf *sftpWalFile) do(f func(*sftp.Client) error) error {
+	wf.mut.Lock()
+	defer wf.mut.Unlock()
+	if wf.client == nil {
+		c, conn, err := wf.connect()
+		if err != nil {
+			return err
+		}
+		wf.client, wf.conn = c, conn
+		// Create the directory (and any parents) if it doesn't exist
+		if err := c.MkdirAll(wf.dir); err != nil {
+			wf.disconnect()
+			return err
+		}
+	}
+	if err := f(wf.client); err != nil {
+		wf.disconnect()
+		return err
+	}
+	return nil
+}
+
+// disconnect closes the client, along with the connection it runs over. The connection is closed first, as the
+// client waits for any outstanding responses on close.
+func (wf *sftpWalFile) disconnect() {
+	wf.conn.Close()
+	wf.client.Close()
+	wf.client, wf.conn = nil, nil
+}
+
+func (wf *sftpWalFile) GetUUID() string {
+	return wf.uuid
+}
+
+func (wf *sftpWalFile) GetRoot() string {
+	return wf.dir
+}
+
+func (wf *sftpWalFile) walPath(fileName string) string {
+	return fmt.Sprintf(path.Join(wf.GetRoot(), walFilePattern), fileName)
+}
+
+func (wf *sftpWalFile) GetMatchingWals(ctx context.Context, matchPattern string) ([]string, error) {
+	fileNames := []string{}
+	err := wf.do(func(c *sftp.Client) error {
+		files, err := c.ReadDir(path.Dir(matchPattern))
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if matched, _ := path.Match(path.Base(matchPattern), f.Name()); matched {
+				fileNames = append(fileNames, strings.Split(strings.Split(f.Name(), "_")[1], ".")[0])
+			}
+		}
+		return nil
+	})
+	return fileNames, err
+}
+
+func (wf *sftpWalFile) GetWalBytes(ctx context.Context, w io.Writer, fileName string) error {
+	var notExist bool
+	err := wf.do(func(c *sftp.Client) error {
+		f, err := c.Open(wf.walPath(fileName))
+		if err != nil {
+			// If the file has been removed, skip, as it means another process has already merged
+			// and deleted this one
+			if errors.Is(err, os.ErrNotExist) {
+				notExist = true
+				return nil
+			}
+			return err
+		}
+		defer f.Close()
+		_, err = f.WriteTo(w)
+		return err
+	})
+	if notExist {
+		return nil
+	}
+	return err
+}
+
+func (wf *sftpWalFile) RemoveWals(ctx context.Context, fileNames []string) error {
+	return wf.do(func(c *sftp.Client) error {
+		for _, f := range fileNames {
+			if err := c.Remove(wf.walPath(f)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (wf *sftpWalFile) Flush(ctx context.Context, b *bytes.Buffer, fileName string) error {
+	p := wf.walPath(fileName)
+	tmp := path.Join(path.Dir(p), tempFilePrefix+path.Base(p)+tempFileSuffix)
+	return wf.do(func(c *sftp.Client) error {
+		f, err := c.Create(tmp)
+		if err != nil {
+			return err
+		}
+		if _, err := f.ReadFrom(bytes.NewReader(b.Bytes())); err != nil {
+			f.Close()
+			c.Remove(tmp)
+			return err
+		}
+		if err := f.Close(); err != nil {
+			c.Remove(tmp)
+			return err
+		}
+		// Unlike Rename, PosixRename replaces an existing wal (e.g. a retried flush)
+		if err := c.PosixRename(tmp, p); err != nil {
+			c.Remove(tmp)
+			return err
+		}
+		return nil
+	})
+}
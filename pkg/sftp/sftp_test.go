@@ -0,0 +1,154 @@
+package sftp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/sftp"
+)
+
+// pipeConn joins the read side of one pipe with the write side of another
+type pipeConn struct {
+	io.Reader
+	io.WriteCloser
+}
+
+// closeCounter counts the connections which have been closed
+type closeCounter struct {
+	io.Closer
+	closed *int
+}
+
+func (c closeCounter) Close() error {
+	*c.closed++
+	return c.Closer.Close()
+}
+
+// newTestWalFile serves the local filesystem over in-memory pipes, in place of an SSH connection. The number of
+// closed connections is written to `closed`, if set.
+func newTestWalFile(t *testing.T, dir string, closed *int) *sftpWalFile {
+	if closed == nil {
+		closed = new(int)
+	}
+	return newSFTPWalFile("test", dir, func() (*sftp.Client, io.Closer, error) {
+		cr, sw := io.Pipe()
+		sr, cw := io.Pipe()
+		server, err := sftp.NewServer(pipeConn{sr, sw})
+		if err != nil {
+			return nil, nil, err
+		}
+		go server.Serve()
+		c, err := sftp.NewClientPipe(cr, cw)
+		if err != nil {
+			server.Close()
+			return nil, nil, err
+		}
+		return c, closeCounter{server, closed}, nil
+	})
+}
+
+func TestSFTPWalFile(t *testing.T) {
+	ctx := context.Background()
+	// The directory and its parents are created on connection
+	dir := filepath.Join(t.TempDir(), "fzn", "wals")
+	wf := newTestWalFile(t, dir, nil)
+	pattern := path.Join(wf.GetRoot(), "wal_*.db")
+
+	if err := wf.Flush(ctx, bytes.NewBufferString("foo"), "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := wf.Flush(ctx, bytes.NewBufferString("bar"), "2"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Temporary files should have been renamed
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("Expected 2 files but got %d", len(entries))
+	}
+	// and are never matched
+	if err := os.WriteFile(filepath.Join(dir, ".wal_3.db.tmp"), []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	wals, err := wf.GetMatchingWals(ctx, pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wals) != 2 || wals[0] != "1" || wals[1] != "2" {
+		t.Fatalf("Expected wals [1 2] but got %v", wals)
+	}
+
+	var b bytes.Buffer
+	if err := wf.GetWalBytes(ctx, &b, "2"); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "bar" {
+		t.Errorf("Expected wal content %q but got %q", "bar", b.String())
+	}
+	// Missing wals have already been merged elsewhere
+	if err := wf.GetWalBytes(ctx, &b, "missing"); err != nil {
+		t.Errorf("Missing wals should be skipped, got %v", err)
+	}
+
+	if err := wf.RemoveWals(ctx, []string{"1", "missing"}); err != nil {
+		t.Fatal(err)
+	}
+	if wals, _ := wf.GetMatchingWals(ctx, pattern); len(wals) != 1 || wals[0] != "2" {
+		t.Errorf("Expected wals [2] but got %v", wals)
+	}
+
+	// Existing wals are replaced
+	if err := wf.Flush(ctx, bytes.NewBufferString("baz"), "2"); err != nil {
+		t.Fatal(err)
+	}
+	b.Reset()
+	if err := wf.GetWalBytes(ctx, &b, "2"); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "baz" {
+		t.Errorf("Expected wal content %q but got %q", "baz", b.String())
+	}
+}
+
+func TestSFTPWalFileConnections(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	var closed int
+
+	// The directory can't be created beneath a file
+	if err := os.WriteFile(filepath.Join(root, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	wf := newTestWalFile(t, filepath.Join(root, "file", "wals"), &closed)
+	if err := wf.Flush(ctx, bytes.NewBufferString("foo"), "1"); err == nil {
+		t.Fatal("Expected an error creating the directory")
+	}
+	if closed != 1 {
+		t.Errorf("Expected the connection to be closed, but got %d closes", closed)
+	}
+
+	// Connections are dropped on error
+	closed = 0
+	wf = newTestWalFile(t, filepath.Join(root, "wals"), &closed)
+	if _, err := wf.GetMatchingWals(ctx, path.Join(root, "missing", "wal_*.db")); err == nil {
+		t.Fatal("Expected an error listing a missing directory")
+	}
+	if closed != 1 {
+		t.Errorf("Expected the connection to be closed, but got %d closes", closed)
+	}
+	if _, err := wf.GetMatchingWals(ctx, path.Join(wf.GetRoot(), "wal_*.db")); err != nil {
+		t.Fatal(err)
+	}
+	if closed != 1 {
+		t.Errorf("Expected a single closed connection, but got %d", closed)
+	}
+}
@@ -0,0 +1,208 @@
+package term
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+
+	"github.com/sambigeara/fuzzynote/pkg/service"
+)
+
+const (
+	agendaTitle       = "Agenda (Esc/Ctrl-w: close)"
+	agendaEmptyPrompt = "No dated items. Add a date to a line (e.g. 2022-03-01, or {d}) to see it here."
+	agendaIndent      = "  "
+)
+
+// agendaView lists dated items, grouped by when they're due, in place of the main list. The items are re-queried on
+// every paint, so they reflect any changes (including those from other devices) immediately.
+type agendaView struct {
+	curKey     string // the selected item, tracked by key as items can move between buckets
+	curIdx     int    // the index of the selected item, used if it no longer exists (e.g. once completed)
+	curX       int    // the cursor position within the selected line
+	vertOffset int    // the index of the first displayed row
+}
+
+// agendaRow is either a bucket header, or an item
+type agendaRow struct {
+	header string
+	item   *service.AgendaItem
+}
+
+func buildAgendaRows(groups []service.AgendaGroup) ([]agendaRow, []service.AgendaItem) {
+	rows := []agendaRow{}
+	items := []service.AgendaItem{}
+	for _, g := range groups {
+		rows = append(rows, agendaRow{header: fmt.Sprintf("%s (%d)", g.Bucket, len(g.Items))})
+		for i := range g.Items {
+			rows = append(rows, agendaRow{item: &g.Items[i]})
+			items = append(items, g.Items[i])
+		}
+	}
+	return rows, items
+}
+
+// resolve updates the selection against the latest items, and returns the selected item, if any
+func (a *agendaView) resolve(items []service.AgendaItem) *service.ListItem {
+	for i, item := range items {
+		if item.Key() == a.curKey {
+			a.curIdx = i
+			break
+		}
+	}
+	if a.curIdx >= len(items) {
+		a.curIdx = len(items) - 1
+	}
+	if a.curIdx < 0 {
+		a.curIdx = 0
+		a.curKey = ""
+		return nil
+	}
+	item := items[a.curIdx].ListItem
+	a.curKey = item.Key()
+	if l := len([]rune(item.Line())); a.curX > l {
+		a.curX = l
+	}
+	return &item
+}
+
+func (a *agendaView) selectIdx(items []service.AgendaItem, idx int) {
+	if idx < 0 || idx >= len(items) {
+		return
+	}
+	a.curIdx = idx
+	a.curKey = items[idx].Key()
+	a.curX = 0
+}
+
+func (t *Terminal) handleAgendaEvent(ev *tcell.EventKey) {
+	a := t.agenda
+	_, items := buildAgendaRows(t.db.GetAgenda(time.Now(), t.c.ShowHidden))
+	cur := a.resolve(items)
+
+	if k := ev.Key(); k == tcell.KeyEscape || k == tcell.KeyCtrlW {
+		t.agenda = nil
+		return
+	}
+	if cur == nil {
+		return
+	}
+
+	line := []rune(cur.Line())
+	var err error
+	switch ev.Key() {
+	case tcell.KeyUp:
+		a.selectIdx(items, a.curIdx-1)
+	case tcell.KeyDown:
+		a.selectIdx(items, a.curIdx+1)
+	case tcell.KeyLeft:
+		if a.curX > 0 {
+			a.curX--
+		}
+	case tcell.KeyRight:
+		if a.curX < len(line) {
+			a.curX++
+		}
+	case tcell.KeyCtrlA:
+		a.curX = 0
+	case tcell.KeyCtrlE:
+		a.curX = len(line)
+	case tcell.KeyCtrlO:
+		t.openNote(cur)
+	case tcell.KeyCtrlV:
+		_, err = t.db.ToggleVisibility(cur)
+	case tcell.KeyCtrlD:
+		_, err = t.db.Delete(cur)
+	case tcell.KeyCtrlU:
+		_, err = t.db.Undo()
+	case tcell.KeyCtrlR:
+		_, err = t.db.Redo()
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if a.curX > 0 {
+			err = t.db.SetLine(string(append(line[:a.curX-1:a.curX-1], line[a.curX:]...)), cur)
+			a.curX--
+		}
+	case tcell.KeyDelete:
+		if a.curX < len(line) {
+			err = t.db.SetLine(string(append(line[:a.curX:a.curX], line[a.curX+1:]...)), cur)
+		}
+	case tcell.KeyRune:
+		newLine := append(append(append([]rune{}, line[:a.curX]...), ev.Rune()), line[a.curX:]...)
+		err = t.db.SetLine(string(newLine), cur)
+		a.curX++
+	}
+	if err != nil {
+		t.footerMessage = "Unable to update item: " + err.Error()
+	}
+}
+
+// paintAgenda renders the agenda within the given region, and returns the cursor position
+func (t *Terminal) paintAgenda(x, y, width, height int) (int, int) {
+	a := t.agenda
+	rows, items := buildAgendaRows(t.db.GetAgenda(time.Now(), t.c.ShowHidden))
+	a.resolve(items)
+
+	titleStyle := tcell.StyleDefault.Foreground(tcell.ColorWhite).Background(tcell.ColorGrey)
+	emitStr(t.S, x, y, titleStyle, padRight(agendaTitle, width))
+	if len(items) == 0 {
+		emitStr(t.S, x, y+1, t.style.Dim(true), agendaEmptyPrompt)
+		return x, y + 1
+	}
+
+	curRow := 0
+	for i, r := range rows {
+		if r.item != nil && r.item.Key() == a.curKey {
+			curRow = i
+			break
+		}
+	}
+	// Keep the selected item on screen, along with its header, where possible
+	listH := height - 1
+	if curRow-1 < a.vertOffset {
+		a.vertOffset = curRow - 1
+	} else if curRow >= a.vertOffset+listH {
+		a.vertOffset = curRow - listH + 1
+	}
+	if a.vertOffset < 0 {
+		a.vertOffset = 0
+	}
+
+	curX, curY := x, y+1
+	for i := a.vertOffset; i < len(rows) && i-a.vertOffset < listH; i++ {
+		rowY := y + 1 + i - a.vertOffset
+		r := rows[i]
+		if r.item == nil {
+			emitStr(t.S, x, rowY, t.style.Bold(true), r.header)
+			continue
+		}
+		style := t.style
+		if len(r.item.Note) > 0 {
+			style = style.Underline(true).Bold(true)
+		}
+		if r.item.IsHidden {
+			style = style.Dim(true)
+		}
+		line := []rune(agendaIndent + r.item.Line())
+		if len(line) > width {
+			line = line[:width]
+		}
+		emitStr(t.S, x, rowY, style, string(line))
+		if i == curRow {
+			curX, curY = x+len(agendaIndent)+a.curX, rowY
+		}
+	}
+	if maxX := x + width - 1; curX > maxX {
+		curX = maxX
+	}
+	return curX, curY
+}
+
+// agendaFooter describes the agenda specific controls
+var agendaFooter = strings.Join([]string{
+	"Ctrl-v: complete",
+	"Ctrl-d: delete",
+	"Ctrl-o: note",
+	"Ctrl-u/Ctrl-r: undo/redo",
+}, " | ")
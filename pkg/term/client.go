@@ -4,11 +4,11 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"math/rand"
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/atotto/clipboard"
 	"github.com/gdamore/tcell/v2"
@@ -36,10 +36,20 @@ type Terminal struct {
 
 	previousKey tcell.Key // Keep track of the previous keypress
 
-	//footerMessage     string    // Because we refresh on an ongoing basis, this needs to be emitted each time we paint
+	notePane      *notePane     // The in-app note editor, nil if closed
+	prompt        *footerPrompt // Active footer input, nil if inactive
+	preview       previewMode
+	showSyncPanel bool
+	agenda        *agendaView // The agenda, which replaces the main list, nil if closed
+	footerMessage string      // Because we refresh on an ongoing basis, this needs to be emitted each time we paint
 }
 
-func NewTerm(db *service.DBListRepo, colour string, editor string) *Terminal {
+func NewTerm(db *service.DBListRepo, colour string, editor string, preview string) (*Terminal, error) {
+	previewMode, err := parsePreviewMode(preview)
+	if err != nil {
+		return nil, err
+	}
+
 	encoding.Register()
 
 	defStyle := tcell.StyleDefault.
@@ -54,14 +64,15 @@ func NewTerm(db *service.DBListRepo, colour string, editor string) *Terminal {
 
 	w, h := s.Size()
 	t := Terminal{
-		db:     db,
-		c:      service.NewClientBase(db, w, h, false),
-		S:      s,
-		style:  defStyle,
-		colour: colour,
-		Editor: editor,
-	}
-	return &t
+		db:      db,
+		c:       service.NewClientBase(db, w, h, false),
+		S:       s,
+		style:   defStyle,
+		colour:  colour,
+		Editor:  editor,
+		preview: previewMode,
+	}
+	return &t, nil
 }
 
 func emitStr(s tcell.Screen, x, y int, style tcell.Style, str string) {
@@ -131,13 +142,45 @@ func (t *Terminal) buildFooter(s tcell.Screen, text string) {
 		Foreground(tcell.ColorBlack).Background(tcell.ColorYellow)
 
 	// Pad out remaining line with spaces to ensure whole bar is filled
-	lenStr := len([]rune(text))
-	text += string(make([]rune, t.c.W-lenStr))
+	text = padRight(text, t.c.W+reservedEndChars)
 	// ReservedBottomLines is subtracted from t.c.H globally, and we want to print on the bottom line
 	// so add it back in here
 	emitStr(s, 0, t.c.H-1+t.c.ReservedBottomLines, footer, text)
 }
 
+// formatEditAttribution returns a short description of who last edited the item, on which device, and when, e.g.
+// "Edited by joe@bloggs.com on laptop 3h ago"
+func formatEditAttribution(item *service.ListItem, device string, now time.Time) string {
+	at := item.LastEditedAt()
+	if at.IsZero() {
+		return ""
+	}
+
+	s := "Edited"
+	if by := item.LastEditedBy(); by != "" {
+		s += " by " + by
+	}
+	if device != "" {
+		s += " on " + device
+	}
+	return s + " " + formatTimeAgo(at, now)
+}
+
+// formatTimeAgo returns a short, human readable description of the time relative to now, e.g. "3h ago"
+func formatTimeAgo(at time.Time, now time.Time) string {
+	switch d := now.Sub(at); {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < time.Hour*24:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	case d < time.Hour*24*30:
+		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+	}
+	return at.Format("Jan 02, 2006")
+}
+
 func (t *Terminal) buildSingleStyleCollabDisplay(s tcell.Screen, style tcell.Style, collaborators []string, xOffset int, yOffset int) {
 	friendStyles := map[tcell.Style][]string{
 		style: []string{},
@@ -162,6 +205,14 @@ func (t *Terminal) resizeScreen() {
 	w, h := t.S.Size()
 	t.c.W = w - reservedEndChars
 	t.c.H = h - t.c.ReservedBottomLines
+	// Bottom panes occupy the bottom half of the screen, so the list (and footer) are rendered above them.
+	// The note pane takes precedence over the preview, as they would both display the same Note. The sync panel
+	// temporarily replaces the preview whilst open.
+	if t.notePane != nil || t.showSyncPanel || t.preview == previewBottom {
+		t.c.H = h/2 - t.c.ReservedBottomLines
+	} else if t.preview == previewRight {
+		t.c.W = w/2 - reservedEndChars
+	}
 }
 
 // A selection of colour combos to apply to collaborators
@@ -196,8 +247,15 @@ func (t *Terminal) paint(matches []service.ListItem, saveWarning bool) error {
 	// Get collaborator map
 	collabMap := t.db.GetCollabPositions()
 
-	// Build top search box
-	t.buildSearchBox(t.S)
+	// The agenda is painted in place of the search box and main list
+	curX, curY := t.c.CurX, t.c.CurY
+	if t.agenda != nil {
+		curX, curY = t.paintAgenda(0, 0, t.c.W+reservedEndChars, t.c.H+t.c.ReservedBottomLines-1)
+		matches = nil
+	} else {
+		// Build top search box
+		t.buildSearchBox(t.S)
+	}
 
 	// Store comma separated strings of collaborator emails against the style
 	collaborators := make(map[tcell.Style][]string)
@@ -248,6 +306,14 @@ func (t *Terminal) paint(matches []service.ListItem, saveWarning bool) error {
 
 		// Emit line
 		emitStr(t.S, 0, offset, style, line)
+		x := len([]rune(line)) + 1
+
+		// Indicate the number of attachments, if any
+		if n := len(r.Attachments()); n > 0 {
+			indicator := fmt.Sprintf("[%d attached]", n)
+			emitStr(t.S, x, offset, t.style.Dim(true), indicator)
+			x += len(indicator) + 1
+		}
 
 		// If the line is shared with anyone, paint the collaborators after the line
 		if friends := r.Friends(); len(friends) > 0 {
@@ -255,7 +321,7 @@ func (t *Terminal) paint(matches []service.ListItem, saveWarning bool) error {
 			// Don't bother displaying friends that are currently being searched for
 			removedSearchFriends := t.c.GetUnsearchedFriends(friends)
 			s := tcell.StyleDefault.Foreground(tcell.ColorBlack).Background(tcell.ColorYellow).Dim(true)
-			t.buildSingleStyleCollabDisplay(t.S, s, removedSearchFriends, len([]rune(line))+1, offset)
+			t.buildSingleStyleCollabDisplay(t.S, s, removedSearchFriends, x, offset)
 		}
 
 		if offset == t.c.H {
@@ -265,7 +331,7 @@ func (t *Terminal) paint(matches []service.ListItem, saveWarning bool) error {
 
 	// If no matches, display help prompt on first line
 	// TODO ordering
-	if len(matches) == 0 {
+	if len(matches) == 0 && t.agenda == nil {
 		if len(t.c.Search) > 0 && len(t.c.Search[0]) > 0 {
 			newLinePrefixPrompt := "Enter: Create new line with search prefix: \"" + service.GetNewLinePrefix(t.c.Search) + "\""
 			emitStr(t.S, 0, t.c.ReservedTopLines, t.style.Dim(true), newLinePrefixPrompt)
@@ -279,31 +345,69 @@ func (t *Terminal) paint(matches []service.ListItem, saveWarning bool) error {
 		t.buildCollabDisplay(t.S, collaborators, 0, t.c.H-2+t.c.ReservedBottomLines)
 	}
 
-	if t.c.CurItem != nil {
+	if t.prompt != nil {
+		// Painted at the end, as the prompt takes the cursor
+	} else if t.footerMessage != "" {
+		t.buildFooter(t.S, t.footerMessage)
+	} else if t.agenda != nil {
+		t.buildFooter(t.S, agendaFooter)
+	} else if t.c.CurItem != nil {
+		s := tcell.StyleDefault.Foreground(tcell.ColorBlack).Background(tcell.ColorYellow)
 		if friends := t.c.CurItem.Friends(); len(friends) > 0 {
 			friends := append([]string{"Shared with:"}, friends...) // Add a prompt as the initial string
-			s := tcell.StyleDefault.Foreground(tcell.ColorBlack).Background(tcell.ColorYellow)
 			t.buildSingleStyleCollabDisplay(t.S, s, friends, 0, t.c.H-1+t.c.ReservedBottomLines)
 		}
+		// Right align the edit attribution
+		if attribution := formatEditAttribution(t.c.CurItem, t.db.LastEditedOn(t.c.CurItem), time.Now()); attribution != "" {
+			emitStr(t.S, t.c.W+reservedEndChars-len([]rune(attribution)), t.c.H-1+t.c.ReservedBottomLines, s.Dim(true), attribution)
+		}
 	}
 
-	t.S.ShowCursor(t.c.CurX, t.c.CurY)
+	w, h := t.S.Size()
+	if t.notePane != nil {
+		paneY := t.c.H + t.c.ReservedBottomLines
+		x, y := t.notePane.paint(t.S, t.style, 0, paneY, w-reservedEndChars, h-paneY)
+		t.S.ShowCursor(x, y)
+	} else if t.showSyncPanel {
+		paneY := t.c.H + t.c.ReservedBottomLines
+		t.paintSyncPanel(0, paneY, w-reservedEndChars, h-paneY, time.Now())
+		t.S.ShowCursor(curX, curY)
+	} else {
+		switch t.preview {
+		case previewRight:
+			// Draw a separator between the list and the preview pane
+			listW := t.c.W + reservedEndChars
+			for y := 0; y < h; y++ {
+				t.S.SetContent(listW, y, '│', nil, t.style.Dim(true))
+			}
+			t.paintPreview(listW+1, 0, w-listW-1, h)
+		case previewBottom:
+			paneY := t.c.H + t.c.ReservedBottomLines
+			t.paintPreview(0, paneY, w-reservedEndChars, h-paneY)
+		}
+		t.S.ShowCursor(curX, curY)
+	}
+	if t.prompt != nil {
+		t.S.ShowCursor(t.paintPrompt(), t.c.H-1+t.c.ReservedBottomLines)
+	}
 	t.S.Show()
 
 	return nil
 }
 
-func (t *Terminal) openEditorSession() error {
+func (t *Terminal) openEditorSession(item *service.ListItem) error {
 	// Write text to temp file
 	tmpfile, err := ioutil.TempFile("", "fzn_buffer")
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-
 	defer os.Remove(tmpfile.Name())
 
-	if _, err := tmpfile.Write(t.c.CurItem.Note); err != nil {
-		log.Fatal(err)
+	if _, err := tmpfile.Write(item.Note); err != nil {
+		tmpfile.Close()
+		return err
+	}
+	if err := tmpfile.Close(); err != nil {
 		return err
 	}
 
@@ -311,32 +415,79 @@ func (t *Terminal) openEditorSession() error {
 	cmd := exec.Command(t.Editor, tmpfile.Name())
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
-	err = cmd.Run()
-	if err != nil {
-		// For now, show a warning and return
-		// TODO make more robust
-		//t.footerMessage = "Unable to open Note using editor setting : \"" + t.Editor + "\""
+	if err := cmd.Run(); err != nil {
+		return err
 	}
 
 	// Read back from the temp file, and return to the write function
 	newDat, err := ioutil.ReadFile(tmpfile.Name())
 	if err != nil {
-		log.Fatal(err)
-		return nil
+		return err
 	}
 
-	err = t.db.UpdateNote(newDat, t.c.CurItem)
-	if err != nil {
-		log.Fatal(err)
-	}
+	return t.db.UpdateNote(newDat, item)
+}
 
-	if err := tmpfile.Close(); err != nil {
-		log.Fatal(err)
+// openNote opens the Note of the item, either in the in-app note pane, or in the configured external editor. If the
+// external editor is not available, it falls back to the note pane.
+func (t *Terminal) openNote(item *service.ListItem) {
+	if t.Editor != internalEditor {
+		if _, err := exec.LookPath(t.Editor); err == nil {
+			if err := t.S.Suspend(); err != nil {
+				t.footerMessage = "Unable to suspend screen: " + err.Error()
+				return
+			}
+			if err := t.openEditorSession(item); err != nil {
+				t.footerMessage = "Unable to open Note using editor setting: \"" + t.Editor + "\""
+			}
+			if err := t.S.Resume(); err != nil {
+				panic("failed to resume: " + err.Error())
+			}
+			return
+		}
+		t.footerMessage = "Editor \"" + t.Editor + "\" not found, using built-in note pane"
 	}
+	t.notePane = newNotePane(item.Key(), item.Note)
+}
 
+// saveNotePane writes the note pane buffer back to the owning ListItem, if it has changed
+func (t *Terminal) saveNotePane() error {
+	p := t.notePane
+	if !p.isDirty {
+		return nil
+	}
+	// Retrieve the latest copy of the item, in case it's been updated (e.g. by collaborators) since opening
+	item, exists := t.db.GetListItem(p.key)
+	if !exists {
+		return errors.New("item no longer exists")
+	}
+	if err := t.db.UpdateNote(p.bytes(), &item); err != nil {
+		return err
+	}
+	p.isDirty = false
 	return nil
 }
 
+func (t *Terminal) handleNotePaneEvent(ev *tcell.EventKey) {
+	w, h := t.S.Size()
+	paneH := h - (h / 2) - 1 // account for the title row
+	save, closePane := t.notePane.handleKey(ev, w-reservedEndChars, paneH)
+	if save {
+		if err := t.saveNotePane(); err != nil {
+			t.footerMessage = "Unable to save Note: " + err.Error()
+			return
+		}
+	}
+	if closePane {
+		t.notePane = nil
+	}
+}
+
+// SetFooterMessage displays the message in the footer until the next key press
+func (t *Terminal) SetFooterMessage(msg string) {
+	t.footerMessage = msg
+}
+
 func (t *Terminal) AwaitEvent() interface{} {
 	return t.S.PollEvent()
 }
@@ -344,7 +495,21 @@ func (t *Terminal) AwaitEvent() interface{} {
 func (t *Terminal) HandleEvent(ev interface{}) error {
 	interactionEvent := service.InteractionEvent{}
 	switch ev := ev.(type) {
+	case service.SyncErrorEvent:
+		t.footerMessage = "Sync error (Ctrl-g for details): " + ev.Err.Error()
 	case *tcell.EventKey:
+		t.footerMessage = ""
+		// Whilst the prompt or note pane are open, they consume all key events
+		if t.prompt != nil {
+			t.handlePromptEvent(ev)
+			break
+		} else if t.notePane != nil {
+			t.handleNotePaneEvent(ev)
+			break
+		} else if t.agenda != nil {
+			t.handleAgendaEvent(ev)
+			break
+		}
 		switch ev.Key() {
 		case tcell.KeyEscape:
 			interactionEvent.T = service.KeyEscape
@@ -358,17 +523,28 @@ func (t *Terminal) HandleEvent(ev interface{}) error {
 			interactionEvent.T = service.KeyDeleteItem
 		case tcell.KeyCtrlO:
 			//interactionEvent.T = service.KeyOpenNote
-			if t.c.CurY+t.c.VertOffset != 0 {
-				if err := t.S.Suspend(); err == nil {
-					err = t.openEditorSession()
-					if err != nil {
-						log.Fatal(err)
-					}
-					if err := t.S.Resume(); err != nil {
-						panic("failed to resume: " + err.Error())
-					}
+			if t.c.CurY+t.c.VertOffset != 0 && t.c.CurItem != nil {
+				t.openNote(t.c.CurItem)
+			}
+		case tcell.KeyCtrlT:
+			if t.c.CurItem != nil {
+				key := t.c.CurItem.Key()
+				t.prompt = &footerPrompt{
+					label:    "Attach file: ",
+					onSubmit: func(p string) { t.attachFile(key, p) },
 				}
 			}
+		case tcell.KeyCtrlF:
+			if t.c.CurItem != nil {
+				t.openAttachments(t.c.CurItem.Attachments())
+			}
+		case tcell.KeyCtrlN:
+			// Cycle through the preview pane modes
+			t.preview = (t.preview + 1) % (previewBottom + 1)
+		case tcell.KeyCtrlG:
+			t.showSyncPanel = !t.showSyncPanel
+		case tcell.KeyCtrlW:
+			t.agenda = &agendaView{}
 		case tcell.KeyCtrlA:
 			interactionEvent.T = service.KeyGotoStart
 		case tcell.KeyCtrlE:
@@ -426,6 +602,9 @@ func (t *Terminal) HandleEvent(ev interface{}) error {
 		interactionEvent.Key = t.c.CurItem.Key()
 	}
 
+	// Ensure the client dimensions reflect any layout changes (e.g. opening the note pane) prior to handling
+	t.resizeScreen()
+
 	matches, _, err := t.c.HandleInteraction(interactionEvent, t.c.Search, t.c.ShowHidden, false, 0)
 	if err != nil {
 		return err
@@ -0,0 +1,265 @@
+package term
+
+import (
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+const (
+	// internalEditor is the `editor` setting which forces use of the in-app note pane
+	internalEditor = "fzn"
+
+	notePaneTitle = "Note (Esc: save and close, Ctrl-s: save)"
+	notePaneTab   = "    "
+)
+
+// notePane is a basic multi-line editor for ListItem Notes. It's rendered in a split view beneath the main
+// list, and is used instead of shelling out to an external editor (e.g. over flaky SSH sessions, or on machines
+// without the configured editor installed).
+type notePane struct {
+	key            string // the key of the ListItem which owns the Note
+	lines          [][]rune
+	curRow, curCol int // the cursor position within the logical (unwrapped) lines
+	vertOffset     int // the index of the first displayed visual (wrapped) row
+	isDirty        bool
+}
+
+// visualRow represents a single wrapped row on the screen, pointing to a slice of a logical line
+type visualRow struct {
+	line, start, end int
+}
+
+func newNotePane(key string, note []byte) *notePane {
+	p := &notePane{
+		key: key,
+	}
+	for _, l := range strings.Split(string(note), "\n") {
+		p.lines = append(p.lines, []rune(l))
+	}
+	return p
+}
+
+func (p *notePane) bytes() []byte {
+	lines := make([]string, len(p.lines))
+	for i, l := range p.lines {
+		lines[i] = string(l)
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// wrapLine returns the start offsets of each wrapped row in the line. Rows are broken on the last space
+// within the width, falling back to a hard break for long words.
+func wrapLine(line []rune, width int) []int {
+	starts := []int{0}
+	if width <= 0 {
+		return starts
+	}
+	start := 0
+	for len(line)-start > width {
+		brk := start + width
+		for i := brk; i > start; i-- {
+			if line[i-1] == ' ' {
+				brk = i
+				break
+			}
+		}
+		starts = append(starts, brk)
+		start = brk
+	}
+	return starts
+}
+
+func (p *notePane) visualRows(width int) []visualRow {
+	rows := []visualRow{}
+	for i, l := range p.lines {
+		starts := wrapLine(l, width)
+		for j, s := range starts {
+			end := len(l)
+			if j < len(starts)-1 {
+				end = starts[j+1]
+			}
+			rows = append(rows, visualRow{i, s, end})
+		}
+	}
+	return rows
+}
+
+// cursorVisualPos returns the index of the visual row that the cursor is on, and the x offset within it
+func (p *notePane) cursorVisualPos(rows []visualRow) (int, int) {
+	idx := 0
+	for i, r := range rows {
+		if r.line != p.curRow {
+			continue
+		}
+		idx = i
+		// The cursor sits on the final row of the line, or on the row which contains the cursor offset
+		if p.curCol < r.end || i == len(rows)-1 || rows[i+1].line != p.curRow {
+			break
+		}
+	}
+	return idx, p.curCol - rows[idx].start
+}
+
+func (p *notePane) moveVisual(rows []visualRow, diff int) {
+	idx, x := p.cursorVisualPos(rows)
+	idx += diff
+	if idx < 0 {
+		idx = 0
+	} else if idx > len(rows)-1 {
+		idx = len(rows) - 1
+	}
+	r := rows[idx]
+	p.curRow = r.line
+	p.curCol = r.start + x
+	if p.curCol > r.end {
+		p.curCol = r.end
+	}
+	// If the row is not the last row of the line, ensure the cursor stays on it (rather than the next one)
+	if idx < len(rows)-1 && rows[idx+1].line == r.line && p.curCol == r.end && r.end > r.start {
+		p.curCol--
+	}
+}
+
+func (p *notePane) insert(rs []rune) {
+	line := p.lines[p.curRow]
+	newLine := make([]rune, 0, len(line)+len(rs))
+	newLine = append(newLine, line[:p.curCol]...)
+	newLine = append(newLine, rs...)
+	newLine = append(newLine, line[p.curCol:]...)
+	p.lines[p.curRow] = newLine
+	p.curCol += len(rs)
+	p.isDirty = true
+}
+
+func (p *notePane) newLine() {
+	line := p.lines[p.curRow]
+	left, right := make([]rune, p.curCol), make([]rune, len(line)-p.curCol)
+	copy(left, line[:p.curCol])
+	copy(right, line[p.curCol:])
+	p.lines[p.curRow] = left
+	p.lines = append(p.lines[:p.curRow+1], append([][]rune{right}, p.lines[p.curRow+1:]...)...)
+	p.curRow++
+	p.curCol = 0
+	p.isDirty = true
+}
+
+func (p *notePane) backspace() {
+	if p.curCol > 0 {
+		line := p.lines[p.curRow]
+		p.lines[p.curRow] = append(line[:p.curCol-1], line[p.curCol:]...)
+		p.curCol--
+		p.isDirty = true
+	} else if p.curRow > 0 {
+		// Merge with the previous line
+		prev := p.lines[p.curRow-1]
+		p.curCol = len(prev)
+		p.lines[p.curRow-1] = append(prev, p.lines[p.curRow]...)
+		p.lines = append(p.lines[:p.curRow], p.lines[p.curRow+1:]...)
+		p.curRow--
+		p.isDirty = true
+	}
+}
+
+func (p *notePane) delete() {
+	line := p.lines[p.curRow]
+	if p.curCol < len(line) {
+		p.lines[p.curRow] = append(line[:p.curCol], line[p.curCol+1:]...)
+		p.isDirty = true
+	} else if p.curRow < len(p.lines)-1 {
+		// Merge the next line into this one
+		p.lines[p.curRow] = append(line, p.lines[p.curRow+1]...)
+		p.lines = append(p.lines[:p.curRow+1], p.lines[p.curRow+2:]...)
+		p.isDirty = true
+	}
+}
+
+// handleKey applies the key event to the buffer. It returns whether the pane should be saved, and whether
+// it should be closed, respectively.
+func (p *notePane) handleKey(ev *tcell.EventKey, width, height int) (bool, bool) {
+	rows := p.visualRows(width)
+	switch ev.Key() {
+	case tcell.KeyEscape:
+		return true, true
+	case tcell.KeyCtrlS:
+		return true, false
+	case tcell.KeyEnter:
+		p.newLine()
+	case tcell.KeyTab:
+		p.insert([]rune(notePaneTab))
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		p.backspace()
+	case tcell.KeyDelete:
+		p.delete()
+	case tcell.KeyLeft:
+		if p.curCol > 0 {
+			p.curCol--
+		} else if p.curRow > 0 {
+			p.curRow--
+			p.curCol = len(p.lines[p.curRow])
+		}
+	case tcell.KeyRight:
+		if p.curCol < len(p.lines[p.curRow]) {
+			p.curCol++
+		} else if p.curRow < len(p.lines)-1 {
+			p.curRow++
+			p.curCol = 0
+		}
+	case tcell.KeyUp:
+		p.moveVisual(rows, -1)
+	case tcell.KeyDown:
+		p.moveVisual(rows, 1)
+	case tcell.KeyPgUp:
+		p.moveVisual(rows, -height)
+	case tcell.KeyPgDn:
+		p.moveVisual(rows, height)
+	case tcell.KeyHome, tcell.KeyCtrlA:
+		p.curCol = 0
+	case tcell.KeyEnd, tcell.KeyCtrlE:
+		p.curCol = len(p.lines[p.curRow])
+	case tcell.KeyRune:
+		p.insert([]rune{ev.Rune()})
+	}
+	return false, false
+}
+
+// paint renders the pane within the given region, and returns the absolute screen position of the cursor
+func (p *notePane) paint(s tcell.Screen, style tcell.Style, x, y, width, height int) (int, int) {
+	titleStyle := tcell.StyleDefault.Foreground(tcell.ColorWhite).Background(tcell.ColorGrey)
+	title := notePaneTitle
+	if p.isDirty {
+		title += " [+]"
+	}
+	emitStr(s, x, y, titleStyle, padRight(title, width))
+
+	// Reserve the title row
+	y++
+	height--
+
+	rows := p.visualRows(width)
+	idx, curX := p.cursorVisualPos(rows)
+
+	// Scroll the buffer so that the cursor remains visible
+	if idx < p.vertOffset {
+		p.vertOffset = idx
+	} else if idx >= p.vertOffset+height {
+		p.vertOffset = idx - height + 1
+	}
+
+	for i := 0; i < height && p.vertOffset+i < len(rows); i++ {
+		r := rows[p.vertOffset+i]
+		emitStr(s, x, y+i, style, string(p.lines[r.line][r.start:r.end]))
+	}
+
+	if curX > width-1 {
+		curX = width - 1
+	}
+	return x + curX, y + idx - p.vertOffset
+}
+
+func padRight(str string, width int) string {
+	if n := width - len([]rune(str)); n > 0 {
+		return str + strings.Repeat(" ", n)
+	}
+	return str
+}
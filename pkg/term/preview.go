@@ -0,0 +1,140 @@
+package term
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+type previewMode int
+
+// The cycle order of the preview modes (via Ctrl-n) follows the order below
+const (
+	previewOff previewMode = iota
+	previewRight
+	previewBottom
+)
+
+var previewModeNames = map[string]previewMode{
+	"off":    previewOff,
+	"right":  previewRight,
+	"bottom": previewBottom,
+}
+
+// parsePreviewMode returns the preview mode for the given name, or an error listing the valid names
+func parsePreviewMode(name string) (previewMode, error) {
+	if m, exists := previewModeNames[name]; exists {
+		return m, nil
+	}
+	names := make([]string, len(previewModeNames))
+	for n, m := range previewModeNames {
+		names[m] = n
+	}
+	return previewOff, fmt.Errorf("unrecognised preview mode %q, valid modes are: %s", name, strings.Join(names, ", "))
+}
+
+const (
+	previewTitle      = "Note preview"
+	previewListBullet = "• "
+	codeFence         = "```"
+)
+
+// styledRow is a single rendered row in the preview pane
+type styledRow struct {
+	text  string
+	style tcell.Style
+}
+
+// renderMarkdown converts a Note into wrapped, styled rows, with basic markdown support for headings,
+// lists and fenced code blocks. Anything else is rendered as plain text.
+func renderMarkdown(note []byte, width int, base tcell.Style) []styledRow {
+	codeStyle := base.Background(tcell.ColorLightGrey).Foreground(tcell.ColorBlack)
+
+	rows := []styledRow{}
+	isCode := false
+	for _, line := range strings.Split(string(note), "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, codeFence) {
+			isCode = !isCode
+			continue
+		}
+
+		// Code blocks are rendered verbatim and truncated rather than wrapped, to preserve alignment
+		if isCode {
+			r := []rune(strings.ReplaceAll(line, "\t", notePaneTab))
+			if len(r) > width {
+				r = r[:width]
+			}
+			rows = append(rows, styledRow{padRight(string(r), width), codeStyle})
+			continue
+		}
+
+		style := base
+		indent := ""
+		text := line
+		if level := headingLevel(trimmed); level > 0 {
+			text = strings.TrimSpace(trimmed[level:])
+			style = style.Bold(true)
+			if level == 1 {
+				style = style.Underline(true)
+			}
+		} else if strings.HasPrefix(trimmed, "- ") || strings.HasPrefix(trimmed, "* ") || strings.HasPrefix(trimmed, "+ ") {
+			// Preserve nesting of list items, and indent any wrapped rows to line up with the item text
+			nesting := line[:len(line)-len(strings.TrimLeftFunc(line, unicode.IsSpace))]
+			text = nesting + previewListBullet + trimmed[2:]
+			indent = strings.Repeat(" ", len([]rune(nesting+previewListBullet)))
+		}
+
+		r := []rune(text)
+		starts := wrapLine(r, width)
+		for i, s := range starts {
+			end := len(r)
+			if i < len(starts)-1 {
+				end = starts[i+1]
+			}
+			row := string(r[s:end])
+			if i > 0 {
+				row = indent + row
+			}
+			rows = append(rows, styledRow{row, style})
+		}
+	}
+	return rows
+}
+
+// headingLevel returns the number of leading `#` chars if the line is a markdown heading, otherwise 0
+func headingLevel(line string) int {
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 || (level < len(line) && line[level] != ' ') {
+		return 0
+	}
+	return level
+}
+
+// paintPreview renders the Note of the current item within the given region
+func (t *Terminal) paintPreview(x, y, width, height int) {
+	// Clear the region, as list lines which exceed the list width will otherwise spill into it
+	blank := strings.Repeat(" ", width)
+	for i := 0; i < height; i++ {
+		emitStr(t.S, x, y+i, t.style, blank)
+	}
+
+	titleStyle := tcell.StyleDefault.Foreground(tcell.ColorWhite).Background(tcell.ColorGrey)
+	emitStr(t.S, x, y, titleStyle, padRight(previewTitle, width))
+
+	if t.c.CurItem == nil || len(t.c.CurItem.Note) == 0 {
+		emitStr(t.S, x, y+1, t.style.Dim(true), "No note")
+		return
+	}
+
+	rows := renderMarkdown(t.c.CurItem.Note, width, t.style)
+	for i := 0; i < height-1 && i < len(rows); i++ {
+		emitStr(t.S, x, y+1+i, rows[i].style, rows[i].text)
+	}
+}
@@ -0,0 +1,115 @@
+package term
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+
+	"github.com/sambigeara/fuzzynote/pkg/service"
+)
+
+// footerPrompt captures a single line of input in the footer (e.g. a file path). Whilst active, it consumes
+// all key events.
+type footerPrompt struct {
+	label    string
+	input    []rune
+	onSubmit func(string)
+}
+
+func (t *Terminal) handlePromptEvent(ev *tcell.EventKey) {
+	p := t.prompt
+	switch ev.Key() {
+	case tcell.KeyEscape:
+		t.prompt = nil
+	case tcell.KeyEnter:
+		t.prompt = nil
+		p.onSubmit(strings.TrimSpace(string(p.input)))
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if len(p.input) > 0 {
+			p.input = p.input[:len(p.input)-1]
+		}
+	case tcell.KeyRune:
+		p.input = append(p.input, ev.Rune())
+	}
+}
+
+// paintPrompt renders the prompt in the footer, and returns the x position of the cursor
+func (t *Terminal) paintPrompt() int {
+	text := t.prompt.label + string(t.prompt.input)
+	t.buildFooter(t.S, text)
+	return len([]rune(text))
+}
+
+func expandPath(p string) (string, error) {
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		p = filepath.Join(home, p[1:])
+	}
+	return filepath.Abs(p)
+}
+
+func (t *Terminal) attachFile(key string, filePath string) {
+	if filePath == "" {
+		return
+	}
+	filePath, err := expandPath(filePath)
+	if err != nil {
+		t.footerMessage = "Unable to resolve path: " + err.Error()
+		return
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		t.footerMessage = "Unable to open file: " + err.Error()
+		return
+	}
+	defer f.Close()
+
+	item, exists := t.db.GetListItem(key)
+	if !exists {
+		t.footerMessage = "Item no longer exists"
+		return
+	}
+	if err := t.db.AddAttachment(context.Background(), &item, filePath, f); err != nil {
+		t.footerMessage = "Unable to attach file: " + err.Error()
+	}
+}
+
+func (t *Terminal) openAttachment(a service.Attachment) {
+	if err := t.c.OpenAttachment(a); err != nil {
+		t.footerMessage = "Unable to open attachment: " + err.Error()
+	}
+}
+
+// openAttachments opens the attachment directly if there's only one, otherwise it prompts for a selection
+func (t *Terminal) openAttachments(attachments []service.Attachment) {
+	switch len(attachments) {
+	case 0:
+		t.footerMessage = "No attachments"
+	case 1:
+		t.openAttachment(attachments[0])
+	default:
+		names := []string{}
+		for i, a := range attachments {
+			names = append(names, fmt.Sprintf("%d: %s", i+1, a.Name))
+		}
+		t.prompt = &footerPrompt{
+			label: fmt.Sprintf("Open attachment (%s): ", strings.Join(names, ", ")),
+			onSubmit: func(s string) {
+				i, err := strconv.Atoi(s)
+				if err != nil || i < 1 || i > len(attachments) {
+					t.footerMessage = "Invalid selection: " + s
+					return
+				}
+				t.openAttachment(attachments[i-1])
+			},
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package term
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+
+	"github.com/sambigeara/fuzzynote/pkg/service"
+)
+
+const (
+	syncPanelTitle = "Sync status"
+	syncPanelNever = "never"
+)
+
+var syncStateNames = map[service.SyncState]string{
+	service.SyncOffline: "Offline",
+	service.SyncSyncing: "Syncing",
+	service.SyncSynced:  "Synced",
+}
+
+// syncPanelColumns defines the headers and widths of the sync panel table. The final column takes the remaining width.
+var syncPanelColumns = []struct {
+	header string
+	width  int
+}{
+	{"TYPE", 7},
+	{"REMOTE", 30},
+	{"LAST PULL", 13},
+	{"LAST PUSH", 13},
+	{"UNPUSHED", 9},
+	{"LAST ERROR", 0},
+}
+
+func formatSyncTime(at time.Time, now time.Time) string {
+	if at.IsZero() {
+		return syncPanelNever
+	}
+	return formatTimeAgo(at, now)
+}
+
+// buildSyncPanelRow pads (or truncates) each cell to the width of its column
+func buildSyncPanelRow(cells []string) string {
+	row := ""
+	for i, c := range cells {
+		if w := syncPanelColumns[i].width; w > 0 {
+			r := []rune(c)
+			if len(r) >= w {
+				r = append(r[:w-2], '…')
+			}
+			c = padRight(string(r), w)
+		}
+		row += c
+	}
+	return row
+}
+
+// isStuck returns whether the WalFile has errored since either its last successful pull, or its last successful push
+func isStuck(s service.WalFileStatus) bool {
+	if s.LastError == nil {
+		return false
+	}
+	// Shared WalFiles are push only
+	if !s.IsOwned || s.Policy.Direction == service.SyncPushOnly {
+		return s.LastErrorAt.After(s.LastPush)
+	}
+	if s.Policy.Direction == service.SyncPullOnly {
+		return s.LastErrorAt.After(s.LastPull)
+	}
+	return s.LastErrorAt.After(s.LastPull) || s.LastErrorAt.After(s.LastPush)
+}
+
+func formatWalFileStatus(s service.WalFileStatus, now time.Time) []string {
+	remote := s.UUID
+	if !s.IsOwned {
+		remote += " (shared)"
+	} else if s.Policy.Direction != service.SyncBoth {
+		remote += fmt.Sprintf(" (%s only)", s.Policy.Direction)
+	}
+	if len(s.Policy.Match) > 0 {
+		remote += fmt.Sprintf(" [%s]", strings.Join(s.Policy.Match, " "))
+	}
+	unpushed := "-"
+	if s.UnpushedEvents > 0 {
+		unpushed = fmt.Sprint(s.UnpushedEvents)
+	}
+	lastErr := ""
+	if s.LastError != nil {
+		lastErr = fmt.Sprintf("%s: %s", formatTimeAgo(s.LastErrorAt, now), s.LastError)
+		if s.RetryAt.After(now) {
+			lastErr += fmt.Sprintf(" (retrying in %s)", s.RetryAt.Sub(now).Round(time.Second))
+		}
+	}
+	return []string{
+		s.Kind,
+		remote,
+		formatSyncTime(s.LastPull, now),
+		formatSyncTime(s.LastPush, now),
+		unpushed,
+		lastErr,
+	}
+}
+
+// formatDevice returns the device name, falling back to the ID if it doesn't have one
+func formatDevice(d service.Device) string {
+	if d.Name != "" {
+		return d.Name
+	}
+	return fmt.Sprint(d.ID)
+}
+
+// paintSyncPanel renders the status of each registered WalFile within the given region
+func (t *Terminal) paintSyncPanel(x, y, width, height int, now time.Time) {
+	blank := strings.Repeat(" ", width)
+	for i := 0; i < height; i++ {
+		emitStr(t.S, x, y+i, t.style, blank)
+	}
+
+	status := t.db.GetSyncStatus()
+
+	titleStyle := tcell.StyleDefault.Foreground(tcell.ColorWhite).Background(tcell.ColorGrey)
+	title := fmt.Sprintf("%s: %s | device: %s | pending events: %d | websocket: %s", syncPanelTitle, syncStateNames[status.State], formatDevice(status.Device), status.PendingEvents, status.WebsocketState)
+	if !status.IsLocalLeader {
+		title += " | local: follower"
+	}
+	if status.LastWebError != nil {
+		title += " (" + status.LastWebError.Error() + ")"
+	}
+	emitStr(t.S, x, y, titleStyle, padRight(title, width))
+
+	headers := []string{}
+	for _, c := range syncPanelColumns {
+		headers = append(headers, c.header)
+	}
+	rows := []string{buildSyncPanelRow(headers)}
+	for _, s := range status.WalFiles {
+		rows = append(rows, buildSyncPanelRow(formatWalFileStatus(s, now)))
+	}
+
+	for i := 0; i < height-1 && i < len(rows); i++ {
+		style := t.style
+		if i == 0 {
+			style = style.Bold(true)
+		} else if isStuck(status.WalFiles[i-1]) {
+			style = style.Foreground(tcell.ColorRed)
+		}
+		r := []rune(rows[i])
+		if len(r) > width {
+			r = r[:width]
+		}
+		emitStr(t.S, x, y+1+i, style, string(r))
+	}
+}
@@ -0,0 +1,287 @@
+package webdav
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	walFilePattern = "wal_%v.db" // TODO dedup, as is in service package
+
+	requestTimeout = time.Second * 30
+)
+
+// WebDAVRemote configures a WebDAV collection (e.g. a Nextcloud folder) as a remote. Authentication is via basic
+// auth; for Nextcloud, an app password should be used.
+type WebDAVRemote struct {
+	URL      string // e.g. https://cloud.example.com/remote.php/dav/files/your_name/fzn
+	User     string
+	Password string
+	Sync     string
+	Match    []string
+}
+
+type webDAVWalFile struct {
+	client   *http.Client
+	url      *url.URL // the collection, with a trailing slash
+	user     string
+	password string
+
+	// Servers which advertise an ETag for collections (e.g. Nextcloud) change it whenever the content of the
+	// collection changes. If it's unchanged since the last listing, we return the cached listing rather than
+	// retrieving the properties of every wal.
+	listingMut  sync.Mutex
+	listingETag string
+	listing     []string
+}
+
+func NewWebDAVWalFile(cfg WebDAVRemote) (*webDAVWalFile, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("url is required")
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported url scheme %q", u.Scheme)
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	return &webDAVWalFile{
+		client:   &http.Client{Timeout: requestTimeout},
+		url:      u,
+		user:     cfg.User,
+		password: cfg.Password,
+	}, nil
+}
+
+func (wf *webDAVWalFile) GetUUID() string {
+	return wf.url.String()
+}
+
+func (wf *webDAVWalFile) GetRoot() string {
+	return wf.url.Path
+}
+
+func (wf *webDAVWalFile) walURL(fileName string) string {
+	u := *wf.url
+	u.Path = path.Join(u.Path, fmt.Sprintf(walFilePattern, fileName))
+	return u.String()
+}
+
+func (wf *webDAVWalFile) do(ctx context.Context, method string, u string, body io.Reader, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if wf.user != "" {
+		req.SetBasicAuth(wf.user, wf.password)
+	}
+	return wf.client.Do(req)
+}
+
+// statusError reads (and closes) the response body, and returns an error including the status
+func statusError(method string, resp *http.Response) error {
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if msg := strings.TrimSpace(string(b)); msg != "" {
+		return fmt.Errorf("%s: %s: %s", method, resp.Status, msg)
+	}
+	return fmt.Errorf("%s: %s", method, resp.Status)
+}
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?><d:propfind xmlns:d="DAV:"><d:prop><d:getetag/><d:resourcetype/></d:prop></d:propfind>`
+
+type multistatus struct {
+	Responses []struct {
+		Href     string `xml:"DAV: href"`
+		Propstat []struct {
+			Prop struct {
+				ETag         string `xml:"DAV: getetag"`
+				ResourceType struct {
+					Collection *struct{} `xml:"DAV: collection"`
+				} `xml:"DAV: resourcetype"`
+			} `xml:"DAV: prop"`
+			Status string `xml:"DAV: status"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+type propfindResult struct {
+	name         string
+	etag         string
+	isCollection bool
+}
+
+// propfind returns the properties of the collection (depth 0), or of the collection and its members (depth 1), or
+// os.ErrNotExist if the collection doesn't exist
+func (wf *webDAVWalFile) propfind(ctx context.Context, depth string) ([]propfindResult, error) {
+	resp, err := wf.do(ctx, "PROPFIND", wf.url.String(), strings.NewReader(propfindBody), http.Header{
+		"Depth":        {depth},
+		"Content-Type": {"application/xml; charset=utf-8"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, os.ErrNotExist
+	}
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, statusError("PROPFIND", resp)
+	}
+	defer resp.Body.Close()
+
+	ms := multistatus{}
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, err
+	}
+	results := []propfindResult{}
+	for _, r := range ms.Responses {
+		href, err := url.PathUnescape(r.Href)
+		if err != nil {
+			continue
+		}
+		res := propfindResult{name: path.Base(href)}
+		for _, ps := range r.Propstat {
+			// Each propstat groups properties by status, and we only want those which were found
+			if !strings.Contains(ps.Status, " 200") {
+				continue
+			}
+			if ps.Prop.ETag != "" {
+				res.etag = ps.Prop.ETag
+			}
+			if ps.Prop.ResourceType.Collection != nil {
+				res.isCollection = true
+			}
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+func (wf *webDAVWalFile) mkcol(ctx context.Context) error {
+	resp, err := wf.do(ctx, "MKCOL", wf.url.String(), nil, nil)
+	if err != nil {
+		return err
+	}
+	// 405 is returned if the collection has since been created
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusMethodNotAllowed {
+		return statusError("MKCOL", resp)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (wf *webDAVWalFile) GetMatchingWals(ctx context.Context, matchPattern string) ([]string, error) {
+	wf.listingMut.Lock()
+	defer wf.listingMut.Unlock()
+
+	collection, err := wf.propfind(ctx, "0")
+	if errors.Is(err, os.ErrNotExist) {
+		return []string{}, wf.mkcol(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	etag := ""
+	if len(collection) > 0 {
+		etag = collection[0].etag
+	}
+	if etag != "" && etag == wf.listingETag {
+		return append([]string{}, wf.listing...), nil
+	}
+
+	members, err := wf.propfind(ctx, "1")
+	if err != nil {
+		return nil, err
+	}
+	fileNames := []string{}
+	for _, m := range members {
+		if m.isCollection {
+			continue
+		}
+		if matched, _ := path.Match(path.Base(matchPattern), m.name); matched {
+			fileNames = append(fileNames, strings.Split(strings.Split(m.name, "_")[1], ".")[0])
+		}
+	}
+
+	wf.listingETag, wf.listing = etag, fileNames
+	return append([]string{}, fileNames...), nil
+}
+
+func (wf *webDAVWalFile) GetWalBytes(ctx context.Context, w io.Writer, fileName string) error {
+	resp, err := wf.do(ctx, http.MethodGet, wf.walURL(fileName), nil, nil)
+	if err != nil {
+		return err
+	}
+	// If the file has been removed, skip, as it means another process has already merged
+	// and deleted this one
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return statusError("GET", resp)
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+func (wf *webDAVWalFile) RemoveWals(ctx context.Context, fileNames []string) error {
+	for _, f := range fileNames {
+		resp, err := wf.do(ctx, http.MethodDelete, wf.walURL(f), nil, nil)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotFound {
+			return statusError("DELETE", resp)
+		}
+		resp.Body.Close()
+	}
+	return nil
+}
+
+func (wf *webDAVWalFile) Flush(ctx context.Context, b *bytes.Buffer, fileName string) error {
+	put := func() (*http.Response, error) {
+		return wf.do(ctx, http.MethodPut, wf.walURL(fileName), bytes.NewReader(b.Bytes()), http.Header{
+			"Content-Type": {"application/octet-stream"},
+		})
+	}
+	resp, err := put()
+	if err != nil {
+		return err
+	}
+	// 409 is returned if the collection doesn't exist yet (although some servers return 404)
+	if resp.StatusCode == http.StatusConflict || resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		if err := wf.mkcol(ctx); err != nil {
+			return err
+		}
+		if resp, err = put(); err != nil {
+			return err
+		}
+	}
+	if resp.StatusCode >= 300 {
+		return statusError("PUT", resp)
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -0,0 +1,115 @@
+package webdav
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+func newTestServer(t *testing.T, wrap func(http.Handler) http.Handler) *webDAVWalFile {
+	var h http.Handler = &webdav.Handler{
+		FileSystem: webdav.Dir(t.TempDir()),
+		LockSystem: webdav.NewMemLS(),
+	}
+	if wrap != nil {
+		h = wrap(h)
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	wf, err := NewWebDAVWalFile(WebDAVRemote{URL: srv.URL + "/fzn"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wf
+}
+
+func TestWebDAVWalFile(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Read and write wals", func(t *testing.T) {
+		wf := newTestServer(t, nil)
+		pattern := path.Join(wf.GetRoot(), "wal_*.db")
+
+		// The collection is created on first use
+		if wals, err := wf.GetMatchingWals(ctx, pattern); err != nil || len(wals) != 0 {
+			t.Fatalf("Expected no wals, got %v, %v", wals, err)
+		}
+		for i, content := range []string{"foo", "bar"} {
+			if err := wf.Flush(ctx, bytes.NewBufferString(content), fmt.Sprint(i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		wals, err := wf.GetMatchingWals(ctx, pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(wals) != 2 {
+			t.Fatalf("Expected 2 wals but got %v", wals)
+		}
+
+		var b bytes.Buffer
+		if err := wf.GetWalBytes(ctx, &b, "1"); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != "bar" {
+			t.Errorf("Expected wal content %q but got %q", "bar", b.String())
+		}
+		if err := wf.GetWalBytes(ctx, &b, "missing"); err != nil {
+			t.Errorf("Missing wals should be skipped, got %v", err)
+		}
+
+		if err := wf.RemoveWals(ctx, []string{"0", "missing"}); err != nil {
+			t.Fatal(err)
+		}
+		if wals, _ := wf.GetMatchingWals(ctx, pattern); len(wals) != 1 || wals[0] != "1" {
+			t.Errorf("Expected wals [1] but got %v", wals)
+		}
+	})
+	t.Run("Unchanged collections aren't re-listed", func(t *testing.T) {
+		// The test server doesn't advertise collection ETags, so we emulate a server which does
+		var etag atomic.Value
+		etag.Store(`"1"`)
+		var listings int32
+		wf := newTestServer(t, func(h http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == "PROPFIND" && r.Header.Get("Depth") == "0" {
+					w.WriteHeader(http.StatusMultiStatus)
+					fmt.Fprintf(w, `<?xml version="1.0"?><d:multistatus xmlns:d="DAV:"><d:response><d:href>%s</d:href><d:propstat><d:prop><d:getetag>%s</d:getetag><d:resourcetype><d:collection/></d:resourcetype></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response></d:multistatus>`, r.URL.Path, etag.Load())
+					return
+				}
+				if r.Method == "PROPFIND" {
+					atomic.AddInt32(&listings, 1)
+				}
+				h.ServeHTTP(w, r)
+			})
+		})
+		pattern := path.Join(wf.GetRoot(), "wal_*.db")
+
+		if err := wf.Flush(ctx, bytes.NewBufferString("foo"), "0"); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			if wals, err := wf.GetMatchingWals(ctx, pattern); err != nil || len(wals) != 1 {
+				t.Fatalf("Expected 1 wal, got %v, %v", wals, err)
+			}
+		}
+		if n := atomic.LoadInt32(&listings); n != 1 {
+			t.Errorf("Expected 1 listing but got %d", n)
+		}
+
+		etag.Store(`"2"`)
+		wf.GetMatchingWals(ctx, pattern)
+		if n := atomic.LoadInt32(&listings); n != 2 {
+			t.Errorf("Expected the changed collection to be listed, got %d listings", n)
+		}
+	})
+}